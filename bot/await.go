@@ -0,0 +1,131 @@
+package bot
+
+import (
+	"context"
+	"slices"
+	"sync"
+
+	"github.com/sandertv/gophertunnel/minecraft/protocol/packet"
+)
+
+// Pending is a registered wait for a packet or event, as returned by Expect and ExpectEvent. Registering
+// the wait before triggering whatever the server responds to means the response can never be missed. The
+// wait is removed as soon as it matched, whether the match is received through Wait or C.
+type Pending[T any] struct {
+	ch     chan T
+	cancel func()
+}
+
+// C returns the channel the first match is sent on.
+func (p *Pending[T]) C() <-chan T {
+	return p.ch
+}
+
+// Wait blocks until the first match arrives or ctx is done. The wait is cancelled afterwards.
+func (p *Pending[T]) Wait(ctx context.Context) (T, error) {
+	defer p.Cancel()
+	select {
+	case v := <-p.ch:
+		return v, nil
+	case <-ctx.Done():
+		var zero T
+		return zero, ctx.Err()
+	}
+}
+
+// Cancel stops waiting. It may be called more than once.
+func (p *Pending[T]) Cancel() {
+	p.cancel()
+}
+
+// Expect starts waiting for the first packet of type T for which predicate returns true. A nil predicate
+// matches any packet of type T. The packet is matched after all handlers of it ran, even if one of them
+// cancelled it, so state such as the World or ScreenManager is already updated when it is received.
+func Expect[T packet.Packet](c *Client, predicate func(T) bool) *Pending[T] {
+	return expect(&c.Events.waiters, predicate)
+}
+
+// Await blocks until a packet of type T for which predicate returns true arrives, or ctx is done.
+func Await[T packet.Packet](ctx context.Context, c *Client, predicate func(T) bool) (T, error) {
+	return Expect(c, predicate).Wait(ctx)
+}
+
+// ExpectEvent starts waiting for the first event of type E for which predicate returns true. A nil
+// predicate matches any event of type E. Events are matched after all subscribers of the EventBus ran.
+// The wait does not subscribe to the EventBus, so ExpectEvent and Cancel may be called from subscribers,
+// but a subscriber must not wait for the event: it is only published after the subscriber returned.
+func ExpectEvent[E any](c *Client, predicate func(E) bool) *Pending[E] {
+	return expect(&c.eventWaiters, predicate)
+}
+
+// AwaitEvent blocks until an event of type E for which predicate returns true is published, or ctx is
+// done. It must not be called from an EventBus subscriber.
+func AwaitEvent[E any](ctx context.Context, c *Client, predicate func(E) bool) (E, error) {
+	return ExpectEvent(c, predicate).Wait(ctx)
+}
+
+// expect adds a wait for the first value of type T for which predicate returns true to the waiters passed.
+func expect[T any](w *waiters, predicate func(T) bool) *Pending[T] {
+	p := &Pending[T]{ch: make(chan T, 1)}
+	wt := &waiter{
+		match: func(v any) bool {
+			t, ok := v.(T)
+			return ok && (predicate == nil || predicate(t))
+		},
+		done: func(v any) {
+			p.ch <- v.(T)
+		},
+	}
+	w.add(wt)
+	p.cancel = func() { w.remove(wt) }
+	return p
+}
+
+// waiter is a single wait added by Expect or ExpectEvent.
+type waiter struct {
+	// match reports whether the packet or event passed is waited for.
+	match func(v any) bool
+	// done is called with the first match, after the waiter was removed.
+	done func(v any)
+}
+
+// waiters holds the waits for packets or events. They are kept apart from packet handlers and the
+// EventBus, so that neither a handler cancelling a packet nor the locks of the EventBus can keep a wait
+// from being matched, added or removed.
+type waiters struct {
+	mu   sync.Mutex
+	list []*waiter
+}
+
+// add adds the waiter passed.
+func (w *waiters) add(wt *waiter) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	// The list is never modified in place, so that notify may range over it without holding the lock.
+	w.list = append(slices.Clip(w.list), wt)
+}
+
+// remove removes the waiter passed and reports whether it was still added.
+func (w *waiters) remove(wt *waiter) bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	i := slices.Index(w.list, wt)
+	if i == -1 {
+		return false
+	}
+	w.list = slices.Delete(slices.Clone(w.list), i, i+1)
+	return true
+}
+
+// notify matches the packet or event passed with every waiter. Waiters that match are removed and receive
+// it, each at most once.
+func (w *waiters) notify(v any) {
+	w.mu.Lock()
+	list := w.list
+	w.mu.Unlock()
+	for _, wt := range list {
+		if wt.match(v) && w.remove(wt) {
+			wt.done(v)
+		}
+	}
+}
@@ -0,0 +1,71 @@
+package bot
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/goxiaoy/go-eventbus"
+	"github.com/sandertv/gophertunnel/minecraft/protocol/packet"
+)
+
+func TestExpectCancelled(t *testing.T) {
+	c := NewClient()
+	AddListener(c, PacketHandler[*packet.Text]{
+		F: func(client *Client, p *packet.Text) error {
+			return Cancel
+		},
+	})
+	p := Expect[*packet.Text](c, func(p *packet.Text) bool { return p.Message == "b" })
+
+	c.Events.dispatch(c, &packet.Text{Message: "a"})
+	select {
+	case pk := <-p.C():
+		t.Fatalf("matched %q, want no match", pk.Message)
+	default:
+	}
+	c.Events.dispatch(c, &packet.Text{Message: "b"})
+	select {
+	case pk := <-p.C():
+		if pk.Message != "b" {
+			t.Errorf("matched %q, want b", pk.Message)
+		}
+	default:
+		t.Fatal("cancelled packet not matched")
+	}
+	if n := len(c.Events.waiters.list); n != 0 {
+		t.Errorf("%v waits left after the match, want 0", n)
+	}
+}
+
+func TestExpectEventFromSubscriber(t *testing.T) {
+	c := NewClient()
+	type trigger struct{}
+	var nested *Pending[*BrokeBlockEvent]
+	_, _ = eventbus.Subscribe[*trigger](c.EventBus)(func(ctx context.Context, e *trigger) error {
+		// Neither adding nor cancelling a wait may block while the EventBus is publishing.
+		ExpectEvent[*BrokeBlockEvent](c, nil).Cancel()
+		nested = ExpectEvent[*BrokeBlockEvent](c, nil)
+		return nil
+	})
+
+	published := make(chan struct{})
+	go func() {
+		defer close(published)
+		_ = publishNow(context.Background(), c, &trigger{})
+		_ = publishNow(context.Background(), c, &BrokeBlockEvent{})
+	}()
+	select {
+	case <-published:
+	case <-time.After(time.Second * 5):
+		t.Fatal("publishing blocked")
+	}
+	select {
+	case <-nested.C():
+	default:
+		t.Fatal("event not matched")
+	}
+	if n := len(c.eventWaiters.list); n != 0 {
+		t.Errorf("%v waits left after the match, want 0", n)
+	}
+}
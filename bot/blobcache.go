@@ -0,0 +1,429 @@
+package bot
+
+import (
+	"container/list"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cespare/xxhash/v2"
+
+	"github.com/sandertv/gophertunnel/minecraft/protocol"
+	"github.com/sandertv/gophertunnel/minecraft/protocol/packet"
+)
+
+// BlobStore stores the chunk blobs of the client blob cache by their hash. Servers only send the blobs a
+// client does not have yet, so a BlobStore shared by clients on the same server, for example through
+// FleetConfig.BlobCache, saves most chunk traffic. Implementations must be safe for concurrent use.
+type BlobStore interface {
+	// Blob returns the blob with the hash passed, if stored.
+	Blob(hash uint64) ([]byte, bool)
+	// StoreBlob stores the blob passed under its hash.
+	StoreBlob(hash uint64, blob []byte)
+}
+
+// Default limits of the blob stores, in bytes.
+const (
+	DefaultMemoryBlobLimit = 64 << 20
+	DefaultDiskBlobLimit   = 1 << 30
+)
+
+// MemoryBlobStore is a BlobStore holding blobs in memory. Once the blobs exceed its limit, the least
+// recently used ones are removed.
+type MemoryBlobStore struct {
+	mu    sync.Mutex
+	blobs *blobLRU
+}
+
+// NewMemoryBlobStore returns an empty MemoryBlobStore with a limit of DefaultMemoryBlobLimit.
+func NewMemoryBlobStore() *MemoryBlobStore {
+	return &MemoryBlobStore{blobs: newBlobLRU(DefaultMemoryBlobLimit)}
+}
+
+// SetLimit sets the number of bytes the blobs may use. A limit of 0 disables the limit.
+func (s *MemoryBlobStore) SetLimit(bytes int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.blobs.setLimit(bytes)
+}
+
+// Blob ...
+func (s *MemoryBlobStore) Blob(hash uint64) ([]byte, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	entry, ok := s.blobs.get(hash)
+	if !ok {
+		return nil, false
+	}
+	return entry.blob, true
+}
+
+// StoreBlob ...
+func (s *MemoryBlobStore) StoreBlob(hash uint64, blob []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.blobs.add(blobEntry{hash: hash, size: int64(len(blob)), blob: blob})
+}
+
+// DiskBlobStore is a BlobStore writing every blob to a file in a directory, so that blobs survive
+// restarts. Blobs read or written are also kept in a MemoryBlobStore. Once the files exceed the limit of
+// the store, the least recently used ones are removed.
+type DiskBlobStore struct {
+	dir string
+	mem *MemoryBlobStore
+
+	mu sync.Mutex
+	// files holds the hash and size of every blob file, without the blob itself.
+	files *blobLRU
+}
+
+// NewDiskBlobStore returns a DiskBlobStore with a limit of DefaultDiskBlobLimit storing blobs in the
+// directory passed, which is created if it does not exist. Blobs stored in the directory before are used.
+func NewDiskBlobStore(dir string) (*DiskBlobStore, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("create blob directory: %w", err)
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("read blob directory: %w", err)
+	}
+	type file struct {
+		hash    uint64
+		size    int64
+		modTime time.Time
+	}
+	var files []file
+	for _, entry := range entries {
+		info, err := entry.Info()
+		if err != nil || !info.Mode().IsRegular() {
+			continue
+		}
+		if strings.HasSuffix(entry.Name(), ".tmp") {
+			// Left behind by a StoreBlob that did not finish.
+			_ = os.Remove(filepath.Join(dir, entry.Name()))
+			continue
+		}
+		hash, err := strconv.ParseUint(entry.Name(), 16, 64)
+		if err != nil {
+			continue
+		}
+		files = append(files, file{hash: hash, size: info.Size(), modTime: info.ModTime()})
+	}
+	// Files are touched when read, so the oldest modification time is the least recently used.
+	slices.SortFunc(files, func(a, b file) int {
+		return a.modTime.Compare(b.modTime)
+	})
+
+	s := &DiskBlobStore{dir: dir, mem: NewMemoryBlobStore(), files: newBlobLRU(DefaultDiskBlobLimit)}
+	for _, f := range files {
+		s.remove(s.files.add(blobEntry{hash: f.hash, size: f.size}))
+	}
+	return s, nil
+}
+
+// SetLimit sets the number of bytes the blob files may use. A limit of 0 disables the limit.
+func (s *DiskBlobStore) SetLimit(bytes int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.remove(s.files.setLimit(bytes))
+}
+
+// Blob ...
+func (s *DiskBlobStore) Blob(hash uint64) ([]byte, bool) {
+	if blob, ok := s.mem.Blob(hash); ok {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if _, ok := s.files.get(hash); ok {
+			s.touch(hash)
+		}
+		return blob, true
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.files.get(hash); !ok {
+		return nil, false
+	}
+	blob, err := os.ReadFile(s.path(hash))
+	if err != nil {
+		return nil, false
+	}
+	s.touch(hash)
+	s.mem.StoreBlob(hash, blob)
+	return blob, true
+}
+
+// StoreBlob ...
+func (s *DiskBlobStore) StoreBlob(hash uint64, blob []byte) {
+	s.mem.StoreBlob(hash, blob)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	// Write to a temporary file first, so that a blob is never read half written.
+	tmp := s.path(hash) + ".tmp"
+	if err := os.WriteFile(tmp, blob, 0644); err != nil {
+		return
+	}
+	if err := os.Rename(tmp, s.path(hash)); err != nil {
+		return
+	}
+	s.remove(s.files.add(blobEntry{hash: hash, size: int64(len(blob))}))
+}
+
+// touch sets the modification time of the file of the blob with the hash passed to now, so that the least
+// recently used blobs are known after a restart. The mutex must be held.
+func (s *DiskBlobStore) touch(hash uint64) {
+	now := time.Now()
+	_ = os.Chtimes(s.path(hash), now, now)
+}
+
+// remove removes the files of the blobs with the hashes passed. The mutex must be held.
+func (s *DiskBlobStore) remove(hashes []uint64) {
+	for _, hash := range hashes {
+		_ = os.Remove(s.path(hash))
+	}
+}
+
+// path returns the path of the file of the blob with the hash passed.
+func (s *DiskBlobStore) path(hash uint64) string {
+	return filepath.Join(s.dir, fmt.Sprintf("%016x", hash))
+}
+
+// blobLRU orders blobs from least to most recently used, and removes the least recently used ones once
+// their total size exceeds a limit. It is not safe for concurrent use.
+type blobLRU struct {
+	limit, size int64
+	order       *list.List
+	entries     map[uint64]*list.Element
+}
+
+// blobEntry is a blob in a blobLRU. blob is nil if only the size of the blob is tracked.
+type blobEntry struct {
+	hash uint64
+	size int64
+	blob []byte
+}
+
+// newBlobLRU returns an empty blobLRU with the limit passed. A limit of 0 disables the limit.
+func newBlobLRU(limit int64) *blobLRU {
+	return &blobLRU{limit: limit, order: list.New(), entries: map[uint64]*list.Element{}}
+}
+
+// get returns the entry with the hash passed and marks it as most recently used.
+func (l *blobLRU) get(hash uint64) (blobEntry, bool) {
+	el, ok := l.entries[hash]
+	if !ok {
+		return blobEntry{}, false
+	}
+	l.order.MoveToBack(el)
+	return el.Value.(blobEntry), true
+}
+
+// add adds the entry passed as most recently used, replacing an entry with the same hash, and returns the
+// hashes of the entries removed to stay within the limit.
+func (l *blobLRU) add(entry blobEntry) []uint64 {
+	if el, ok := l.entries[entry.hash]; ok {
+		l.size -= el.Value.(blobEntry).size
+		l.order.Remove(el)
+	}
+	l.entries[entry.hash] = l.order.PushBack(entry)
+	l.size += entry.size
+	return l.evict()
+}
+
+// setLimit sets the limit and returns the hashes of the entries removed to stay within it.
+func (l *blobLRU) setLimit(limit int64) []uint64 {
+	l.limit = limit
+	return l.evict()
+}
+
+// evict removes the least recently used entries until the size is within the limit and returns their
+// hashes.
+func (l *blobLRU) evict() []uint64 {
+	var evicted []uint64
+	for l.limit > 0 && l.size > l.limit {
+		entry := l.order.Remove(l.order.Front()).(blobEntry)
+		delete(l.entries, entry.hash)
+		l.size -= entry.size
+		evicted = append(evicted, entry.hash)
+	}
+	return evicted
+}
+
+// blobCache tracks the chunks and sub chunks of a session waiting for blobs missing from the BlobStore.
+type blobCache struct {
+	store BlobStore
+
+	mu      sync.Mutex
+	waiting map[uint64][]*pendingBlobs
+}
+
+// pendingBlobs is a chunk or sub chunk waiting for blobs. The blobs are kept with it, so that it can be
+// resolved even if the BlobStore removed some of them in the meantime.
+type pendingBlobs struct {
+	hashes  []uint64
+	blobs   map[uint64][]byte
+	missing map[uint64]struct{}
+	// resolve is called with the blobs concatenated in the order of hashes once none are missing.
+	resolve func(data []byte) error
+}
+
+// done calls resolve with the blobs of the pendingBlobs.
+func (p *pendingBlobs) done() error {
+	var data []byte
+	for _, hash := range p.hashes {
+		data = append(data, p.blobs[hash]...)
+	}
+	return p.resolve(data)
+}
+
+// newBlobCache returns a blobCache for a new session using the store passed, or a MemoryBlobStore if nil.
+func newBlobCache(store BlobStore) *blobCache {
+	if store == nil {
+		store = NewMemoryBlobStore()
+	}
+	return &blobCache{store: store, waiting: map[uint64][]*pendingBlobs{}}
+}
+
+// track registers resolve to be called once all blobs with the hashes passed are known. It returns the
+// pendingBlobs and the hashes of the blobs already stored and of those missing. If none are missing,
+// resolve is not called and the caller resolves immediately with done.
+func (b *blobCache) track(hashes []uint64, resolve func(data []byte) error) (p *pendingBlobs, hits, misses []uint64) {
+	p = &pendingBlobs{hashes: hashes, blobs: map[uint64][]byte{}, missing: map[uint64]struct{}{}, resolve: resolve}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for _, hash := range hashes {
+		if _, ok := p.blobs[hash]; ok {
+			continue
+		}
+		if blob, ok := b.store.Blob(hash); ok {
+			p.blobs[hash] = blob
+			hits = append(hits, hash)
+			continue
+		}
+		if _, ok := p.missing[hash]; ok {
+			continue
+		}
+		p.missing[hash] = struct{}{}
+		misses = append(misses, hash)
+		b.waiting[hash] = append(b.waiting[hash], p)
+	}
+	return p, hits, misses
+}
+
+// clear forgets all chunks and sub chunks waiting for blobs, as is needed when the client changes dimension
+// or respawns, after which they are sent again. Blobs that arrive for them afterwards are still stored.
+func (b *blobCache) clear() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	clear(b.waiting)
+}
+
+// receive stores the blobs passed and resolves all chunks that no longer miss any blob. Blobs of which the
+// payload does not match the hash are dropped, and the chunks waiting for them are never resolved.
+func (b *blobCache) receive(blobs []protocol.CacheBlob) error {
+	var (
+		resolved []*pendingBlobs
+		errs     []error
+	)
+	b.mu.Lock()
+	for _, blob := range blobs {
+		if hash := xxhash.Sum64(blob.Payload); hash != blob.Hash {
+			errs = append(errs, fmt.Errorf("blob %016x has hash %016x", blob.Hash, hash))
+			continue
+		}
+		b.store.StoreBlob(blob.Hash, blob.Payload)
+		for _, p := range b.waiting[blob.Hash] {
+			p.blobs[blob.Hash] = blob.Payload
+			delete(p.missing, blob.Hash)
+			if len(p.missing) == 0 {
+				resolved = append(resolved, p)
+			}
+		}
+		delete(b.waiting, blob.Hash)
+	}
+	b.mu.Unlock()
+
+	for _, p := range resolved {
+		if err := p.done(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// cachedLevelChunk rebuilds the payload of a LevelChunk sent with blob hashes once all blobs are known.
+// The hashes hold the blobs of the sub chunks, if any, followed by the blob of the biomes.
+func (e *EventsListener) cachedLevelChunk(c *Client, p *packet.LevelChunk) error {
+	dimension := e.dimension()
+	pending, hits, misses := e.blobs.track(p.BlobHashes, func(data []byte) error {
+		if e.dimension() != dimension {
+			// The client left the dimension of the chunk before all blobs arrived.
+			return nil
+		}
+		pk := *p
+		pk.CacheEnabled, pk.BlobHashes = false, nil
+		pk.RawPayload = append(data, p.RawPayload...)
+		return e.readLevelChunk(c, &pk)
+	})
+	if err := c.WritePacket(&packet.ClientCacheBlobStatus{MissHashes: misses, HitHashes: hits}); err != nil {
+		return err
+	}
+	if len(misses) == 0 {
+		return pending.done()
+	}
+	return nil
+}
+
+// cachedSubChunks decodes the entries of a SubChunk response sent with blob hashes once all blobs are
+// known. The payload of such an entry only holds the block entities of the sub chunk.
+func (e *EventsListener) cachedSubChunks(c *Client, p *packet.SubChunk) error {
+	if int(p.Dimension) != e.dimension() {
+		return nil
+	}
+	r := e.dimensionRange(e.dimension())
+	if c.world == nil {
+		c.world = c.worldFor(e.dimension(), r)
+	}
+	var (
+		status packet.ClientCacheBlobStatus
+		ready  []*pendingBlobs
+	)
+	for _, entry := range p.SubChunkEntries {
+		if entry.Result != protocol.SubChunkResultSuccess {
+			if err := e.readSubChunk(c, r, p.Position, entry); err != nil {
+				c.Logger.Warnf("Failed to decode sub chunk: %v", err)
+			}
+			continue
+		}
+		pending, hits, misses := e.blobs.track([]uint64{entry.BlobHash}, func(data []byte) error {
+			if e.dimension() != int(p.Dimension) {
+				// The client left the dimension of the sub chunk before its blob arrived.
+				return nil
+			}
+			entry.RawPayload = append(data, entry.RawPayload...)
+			if err := e.readSubChunk(c, r, p.Position, entry); err != nil {
+				c.Logger.Warnf("Failed to decode sub chunk: %v", err)
+			}
+			return nil
+		})
+		status.HitHashes = append(status.HitHashes, hits...)
+		status.MissHashes = append(status.MissHashes, misses...)
+		if len(misses) == 0 {
+			ready = append(ready, pending)
+		}
+	}
+	if err := c.WritePacket(&status); err != nil {
+		return err
+	}
+	for _, pending := range ready {
+		if err := pending.done(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,187 @@
+package bot
+
+import (
+	"bytes"
+	"os"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/cespare/xxhash/v2"
+	"github.com/sandertv/gophertunnel/minecraft/protocol"
+)
+
+func TestBlobLRU(t *testing.T) {
+	type op struct {
+		add      uint64
+		get      uint64
+		limit    int64
+		want     []uint64
+		wantSize int64
+	}
+	tests := []struct {
+		name  string
+		limit int64
+		ops   []op
+	}{
+		{
+			name:  "least recently added evicted",
+			limit: 8,
+			ops: []op{
+				{add: 1, wantSize: 4},
+				{add: 2, wantSize: 8},
+				{add: 3, want: []uint64{1}, wantSize: 8},
+			},
+		},
+		{
+			name:  "get marks used",
+			limit: 8,
+			ops: []op{
+				{add: 1, wantSize: 4},
+				{add: 2, wantSize: 8},
+				{get: 1, wantSize: 8},
+				{add: 3, want: []uint64{2}, wantSize: 8},
+			},
+		},
+		{
+			name:  "replacing keeps size",
+			limit: 8,
+			ops: []op{
+				{add: 1, wantSize: 4},
+				{add: 1, wantSize: 4},
+				{add: 2, wantSize: 8},
+			},
+		},
+		{
+			name:  "lowering limit",
+			limit: 0,
+			ops: []op{
+				{add: 1, wantSize: 4},
+				{add: 2, wantSize: 8},
+				{add: 3, wantSize: 12},
+				{limit: 5, want: []uint64{1, 2}, wantSize: 4},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := newBlobLRU(tt.limit)
+			for i, o := range tt.ops {
+				var evicted []uint64
+				switch {
+				case o.add != 0:
+					evicted = l.add(blobEntry{hash: o.add, size: 4})
+				case o.get != 0:
+					if _, ok := l.get(o.get); !ok {
+						t.Fatalf("op %v: blob %v not found", i, o.get)
+					}
+				default:
+					evicted = l.setLimit(o.limit)
+				}
+				if !slices.Equal(evicted, o.want) {
+					t.Errorf("op %v: evicted %v, want %v", i, evicted, o.want)
+				}
+				if l.size != o.wantSize {
+					t.Errorf("op %v: size %v, want %v", i, l.size, o.wantSize)
+				}
+			}
+		})
+	}
+}
+
+func TestBlobCacheReceive(t *testing.T) {
+	a, b := []byte("first blob"), []byte("second blob")
+	hashA, hashB := xxhash.Sum64(a), xxhash.Sum64(b)
+
+	cache := newBlobCache(nil)
+	var resolved []byte
+	_, hits, misses := cache.track([]uint64{hashA, hashB}, func(data []byte) error {
+		resolved = data
+		return nil
+	})
+	if len(hits) != 0 || !slices.Equal(misses, []uint64{hashA, hashB}) {
+		t.Fatalf("hits %v and misses %v, want all missing", hits, misses)
+	}
+
+	// A blob of which the payload does not match its hash is dropped.
+	if err := cache.receive([]protocol.CacheBlob{{Hash: hashA, Payload: b}, {Hash: hashB, Payload: b}}); err == nil {
+		t.Error("no error for a blob with the wrong hash")
+	}
+	if resolved != nil {
+		t.Fatal("resolved with a blob of the wrong hash")
+	}
+	if _, ok := cache.store.Blob(hashA); ok {
+		t.Error("blob with the wrong hash stored")
+	}
+
+	if err := cache.receive([]protocol.CacheBlob{{Hash: hashA, Payload: a}}); err != nil {
+		t.Fatal(err)
+	}
+	if want := append(slices.Clone(a), b...); !bytes.Equal(resolved, want) {
+		t.Errorf("resolved %q, want %q", resolved, want)
+	}
+	if n := len(cache.waiting); n != 0 {
+		t.Errorf("%v blobs still waited for, want 0", n)
+	}
+}
+
+func TestBlobCacheClear(t *testing.T) {
+	blob := []byte("blob")
+	hash := xxhash.Sum64(blob)
+
+	cache := newBlobCache(nil)
+	resolved := false
+	cache.track([]uint64{hash}, func(data []byte) error {
+		resolved = true
+		return nil
+	})
+	cache.clear()
+	if err := cache.receive([]protocol.CacheBlob{{Hash: hash, Payload: blob}}); err != nil {
+		t.Fatal(err)
+	}
+	if resolved {
+		t.Error("chunk resolved after clear")
+	}
+	if _, ok := cache.store.Blob(hash); !ok {
+		t.Error("blob received after clear not stored")
+	}
+}
+
+func TestDiskBlobStoreLRU(t *testing.T) {
+	dir := t.TempDir()
+	s, err := NewDiskBlobStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	blobs := [][]byte{[]byte("blob 0"), []byte("blob 1"), []byte("blob 2")}
+	for i, blob := range blobs {
+		s.StoreBlob(uint64(i), blob)
+		// Use distinct modification times in the past, oldest first.
+		old := time.Now().Add(time.Duration(i-10) * time.Minute)
+		if err := os.Chtimes(s.path(uint64(i)), old, old); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Blob 0 is still held in memory, but using it must mark the file as used too.
+	if _, ok := s.Blob(0); !ok {
+		t.Fatal("blob 0 not found")
+	}
+
+	// After a restart, the least recently used file is removed first.
+	s, err = NewDiskBlobStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.SetLimit(int64(len(blobs[0]) * 2))
+	for i, want := range []bool{true, false, true} {
+		if _, err := os.Stat(s.path(uint64(i))); (err == nil) != want {
+			t.Errorf("file of blob %v exists: %v, want %v", i, err == nil, want)
+		}
+	}
+	if blob, ok := s.Blob(0); !ok || !bytes.Equal(blob, blobs[0]) {
+		t.Errorf("blob 0 after restart = %q, want %q", blob, blobs[0])
+	}
+	if _, ok := s.Blob(1); ok {
+		t.Error("evicted blob 1 still found")
+	}
+}
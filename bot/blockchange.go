@@ -0,0 +1,114 @@
+package bot
+
+import (
+	"context"
+
+	"github.com/df-mc/dragonfly/server/block/cube"
+	"github.com/df-mc/dragonfly/server/world"
+	"github.com/df-mc/dragonfly/server/world/chunk"
+	"github.com/goxiaoy/go-eventbus"
+)
+
+// BlockChangeSource is the kind of packet a block change was received in.
+type BlockChangeSource int
+
+const (
+	// BlockChangeUpdate is a change of a single block, sent in an UpdateBlock packet.
+	BlockChangeUpdate BlockChangeSource = iota
+	// BlockChangeSubChunkBatch is a change sent in an UpdateSubChunkBlocks packet together with other
+	// changes.
+	BlockChangeSubChunkBatch
+	// BlockChangeChunkLoad is a change found by comparing a chunk or sub chunk sent again by the server
+	// with the one already loaded.
+	BlockChangeChunkLoad
+)
+
+// String ...
+func (s BlockChangeSource) String() string {
+	switch s {
+	case BlockChangeUpdate:
+		return "update"
+	case BlockChangeSubChunkBatch:
+		return "sub chunk batch"
+	case BlockChangeChunkLoad:
+		return "chunk load"
+	}
+	return "unknown"
+}
+
+// BlockChangeFilter selects the BlockChangeEvents passed to a handler added with OnBlockChange. The zero
+// value matches every change.
+type BlockChangeFilter struct {
+	// Region, if not zero, only matches changes of blocks within it.
+	Region cube.BBox
+	// Match, if set, only matches changes from or to a block it returns true for, for example a predicate
+	// returned by BlockName.
+	Match func(world.Block) bool
+}
+
+// matches checks if the filter matches the event passed.
+func (f BlockChangeFilter) matches(e *BlockChangeEvent) bool {
+	if f.Region != (cube.BBox{}) && !f.Region.Vec3Within(e.Position.Vec3Centre()) {
+		return false
+	}
+	return f.Match == nil || f.Match(e.Old) || f.Match(e.New)
+}
+
+// OnBlockChange calls f with every BlockChangeEvent matching the filter passed. The returned IDisposable
+// removes the handler again.
+func OnBlockChange(c *Client, filter BlockChangeFilter, f func(e *BlockChangeEvent)) (eventbus.IDisposable, error) {
+	return eventbus.Subscribe[*BlockChangeEvent](c.EventBus)(func(ctx context.Context, e *BlockChangeEvent) error {
+		if filter.matches(e) {
+			f(e)
+		}
+		return nil
+	})
+}
+
+// changeBlock sets a block in the World of the client and publishes a BlockChangeEvent if it changed.
+// Blocks in columns that are not loaded are ignored. It reports whether a block on layer 0 that was not
+// air was replaced by air.
+func (c *Client) changeBlock(pos cube.Pos, layer uint8, rid, flags uint32, source BlockChangeSource) (broke bool) {
+	old, ok := c.world.swapBlock(pos, layer, rid)
+	if !ok || old == rid {
+		return false
+	}
+	oldB, _ := world.BlockByRuntimeID(old)
+	newB, _ := world.BlockByRuntimeID(rid)
+	publishEvent(c, &BlockChangeEvent{Position: pos, Old: oldB, New: newB, Layer: layer, Flags: flags, Source: source})
+	return layer == 0 && rid == air
+}
+
+// diffSubChunks publishes a BlockChangeEvent for every block that differs between a sub chunk already
+// loaded and the one replacing it. The events of a sub chunk are published in order as one batch. Callers
+// must not pass sub chunks that were not received yet, as those are empty without being air.
+func (c *Client) diffSubChunks(pos world.ChunkPos, subY int, old, new *chunk.SubChunk) {
+	if old == nil || new == nil || old == new || old.Equals(new) {
+		return
+	}
+	var changes []*BlockChangeEvent
+	base := cube.Pos{int(pos[0]) << 4, subY << 4, int(pos[1]) << 4}
+	layers := max(len(old.Layers()), len(new.Layers()))
+	for layer := uint8(0); int(layer) < layers; layer++ {
+		for x := uint8(0); x < 16; x++ {
+			for y := uint8(0); y < 16; y++ {
+				for z := uint8(0); z < 16; z++ {
+					o, n := old.Block(x, y, z, layer), new.Block(x, y, z, layer)
+					if o == n {
+						continue
+					}
+					oldB, _ := world.BlockByRuntimeID(o)
+					newB, _ := world.BlockByRuntimeID(n)
+					changes = append(changes, &BlockChangeEvent{
+						Position: base.Add(cube.Pos{int(x), int(y), int(z)}),
+						Old:      oldB,
+						New:      newB,
+						Layer:    layer,
+						Source:   BlockChangeChunkLoad,
+					})
+				}
+			}
+		}
+	}
+	publishEvents(c, changes)
+}
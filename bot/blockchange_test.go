@@ -0,0 +1,39 @@
+package bot
+
+import (
+	"testing"
+
+	"github.com/df-mc/dragonfly/server/block"
+	"github.com/df-mc/dragonfly/server/block/cube"
+	"github.com/df-mc/dragonfly/server/world"
+)
+
+func TestChangeBlockBroke(t *testing.T) {
+	stone := world.BlockRuntimeID(block.Stone{})
+	tests := []struct {
+		name  string
+		pos   cube.Pos
+		layer uint8
+		old   uint32
+		rid   uint32
+		want  bool
+	}{
+		{name: "broken", old: stone, rid: air, want: true},
+		{name: "air already", old: air, rid: air},
+		{name: "placed", old: air, rid: stone},
+		{name: "extra layer", layer: 1, old: stone, rid: air},
+		{name: "not loaded", pos: cube.Pos{16, 0, 0}, old: stone, rid: air},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := NewClient()
+			c.world = NewWorld(world.Overworld.Range())
+			testColumns(c.world, 0, world.ChunkPos{})
+			c.world.swapBlock(cube.Pos{0, 0, 0}, tt.layer, tt.old)
+			c.world.swapBlock(cube.Pos{16, 0, 0}, tt.layer, tt.old)
+			if broke := c.changeBlock(tt.pos, tt.layer, tt.rid, 0, BlockChangeSubChunkBatch); broke != tt.want {
+				t.Errorf("changeBlock() = %v, want %v", broke, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,307 @@
+package bot
+
+import (
+	"image/color"
+	"maps"
+	"slices"
+	"time"
+
+	"github.com/df-mc/dragonfly/server/block"
+	"github.com/df-mc/dragonfly/server/block/cube"
+	"github.com/df-mc/dragonfly/server/item"
+	"github.com/df-mc/dragonfly/server/item/inventory"
+	"github.com/patyhank/bedrock-library/internal/nbtconv"
+)
+
+// SignText is the text on one side of a sign.
+type SignText struct {
+	Text   string
+	Colour color.RGBA
+	// Glowing is true if the text was dyed with a glow ink sac.
+	Glowing bool
+	// Owner is the XUID of the player that wrote the text, if known.
+	Owner string
+}
+
+// Sign is the block entity of a sign or hanging sign.
+type Sign struct {
+	Front, Back SignText
+	// Waxed is true if the sign can no longer be edited.
+	Waxed   bool
+	Hanging bool
+}
+
+// Sign returns the sign at the position passed. False is returned if there is no sign block entity at the
+// position.
+func (w *World) Sign(pos cube.Pos) (Sign, bool) {
+	m, ok := w.blockEntityOf(pos, "Sign", "HangingSign")
+	if !ok {
+		return Sign{}, false
+	}
+	s := Sign{Waxed: nbtconv.Bool(m, "IsWaxed"), Hanging: nbtconv.String(m, "id") == "HangingSign"}
+	if text := nbtconv.String(m, "Text"); text != "" {
+		// Signs from before 1.19.80 only have one side.
+		s.Front = signText(m)
+		return s, true
+	}
+	if front, ok := m["FrontText"].(map[string]any); ok {
+		s.Front = signText(front)
+	}
+	if back, ok := m["BackText"].(map[string]any); ok {
+		s.Back = signText(back)
+	}
+	return s, true
+}
+
+// signText decodes the text of one side of a sign.
+func signText(m map[string]any) SignText {
+	return SignText{
+		Text:    nbtconv.String(m, "Text"),
+		Colour:  nbtconv.RGBAFromInt32(nbtconv.Int32(m, "SignTextColor")),
+		Glowing: nbtconv.Bool(m, "IgnoreLighting"),
+		Owner:   nbtconv.String(m, "TextOwner"),
+	}
+}
+
+// Chest is the block entity of a chest or trapped chest.
+type Chest struct {
+	CustomName string
+	// Paired is true if the chest forms a double chest with the chest at Pair.
+	Paired bool
+	Pair   cube.Pos
+	// PairLead is true if this chest is the half of the double chest holding the custom name.
+	PairLead bool
+	// Items holds the items of the chest by slot, if sent by the server. Most servers only send them when
+	// the chest is opened.
+	Items []item.Stack
+}
+
+// Chest returns the chest at the position passed. False is returned if there is no chest block entity at
+// the position.
+func (w *World) Chest(pos cube.Pos) (Chest, bool) {
+	m, ok := w.blockEntityOf(pos, "Chest")
+	if !ok {
+		return Chest{}, false
+	}
+	c := Chest{CustomName: nbtconv.String(m, "CustomName"), PairLead: nbtconv.Bool(m, "pairlead"), Items: containerItems(m, 27)}
+	if _, ok := m["pairx"]; ok {
+		c.Paired = true
+		c.Pair = cube.Pos{int(nbtconv.Int32(m, "pairx")), pos[1], int(nbtconv.Int32(m, "pairz"))}
+	}
+	return c, true
+}
+
+// ShulkerBox is the block entity of a shulker box.
+type ShulkerBox struct {
+	CustomName string
+	Facing     cube.Face
+	// Items holds the items of the shulker box by slot, if sent by the server.
+	Items []item.Stack
+}
+
+// ShulkerBox returns the shulker box at the position passed. False is returned if there is no shulker box
+// block entity at the position.
+func (w *World) ShulkerBox(pos cube.Pos) (ShulkerBox, bool) {
+	m, ok := w.blockEntityOf(pos, "ShulkerBox")
+	if !ok {
+		return ShulkerBox{}, false
+	}
+	return ShulkerBox{
+		CustomName: nbtconv.String(m, "CustomName"),
+		Facing:     cube.Face(nbtconv.Uint8(m, "facing")),
+		Items:      containerItems(m, 27),
+	}, true
+}
+
+// Furnace is the block entity of a furnace, blast furnace or smoker.
+type Furnace struct {
+	// Kind is the ID of the block entity: Furnace, BlastFurnace or Smoker.
+	Kind string
+	// BurnTime is the time left until the fuel burning is used up, and BurnDuration the total time the fuel
+	// burns for.
+	BurnTime, BurnDuration time.Duration
+	// CookTime is the time the item being smelted has been cooking for.
+	CookTime time.Duration
+	// Items holds the input, fuel and output, if sent by the server.
+	Items []item.Stack
+}
+
+// Progress returns how far the item being smelted is, from 0 to 1.
+func (f Furnace) Progress() float64 {
+	total := time.Second * 10
+	if f.Kind != "Furnace" {
+		// Blast furnaces and smokers smelt twice as fast.
+		total /= 2
+	}
+	return min(float64(f.CookTime)/float64(total), 1)
+}
+
+// Fuel returns how much of the fuel burning is left, from 0 to 1.
+func (f Furnace) Fuel() float64 {
+	if f.BurnDuration == 0 {
+		return 0
+	}
+	return min(float64(f.BurnTime)/float64(f.BurnDuration), 1)
+}
+
+// Furnace returns the furnace, blast furnace or smoker at the position passed. False is returned if there
+// is no such block entity at the position.
+func (w *World) Furnace(pos cube.Pos) (Furnace, bool) {
+	m, ok := w.blockEntityOf(pos, "Furnace", "BlastFurnace", "Smoker")
+	if !ok {
+		return Furnace{}, false
+	}
+	return Furnace{
+		Kind:         nbtconv.String(m, "id"),
+		BurnTime:     nbtconv.TickDuration[int16](m, "BurnTime"),
+		BurnDuration: nbtconv.TickDuration[int16](m, "BurnDuration"),
+		CookTime:     nbtconv.TickDuration[int16](m, "CookTime"),
+		Items:        containerItems(m, 3),
+	}, true
+}
+
+// Spawner is the block entity of a monster spawner.
+type Spawner struct {
+	// EntityType is the identifier of the entity spawned, such as minecraft:zombie. It is empty if the
+	// spawner spawns nothing.
+	EntityType string
+	// Delay is the time until the next spawn attempt.
+	Delay                        time.Duration
+	MinSpawnDelay, MaxSpawnDelay time.Duration
+	SpawnCount                   int
+	// SpawnRange is the distance from the spawner that entities may spawn at.
+	SpawnRange int
+	// RequiredPlayerRange is the distance within which a player must be for the spawner to spawn.
+	RequiredPlayerRange int
+	MaxNearbyEntities   int
+}
+
+// Spawner returns the monster spawner at the position passed. False is returned if there is no spawner
+// block entity at the position.
+func (w *World) Spawner(pos cube.Pos) (Spawner, bool) {
+	m, ok := w.blockEntityOf(pos, "MobSpawner")
+	if !ok {
+		return Spawner{}, false
+	}
+	return Spawner{
+		EntityType:          nbtconv.String(m, "EntityIdentifier"),
+		Delay:               nbtconv.TickDuration[int16](m, "Delay"),
+		MinSpawnDelay:       nbtconv.TickDuration[int16](m, "MinSpawnDelay"),
+		MaxSpawnDelay:       nbtconv.TickDuration[int16](m, "MaxSpawnDelay"),
+		SpawnCount:          int(nbtconv.Int16(m, "SpawnCount")),
+		SpawnRange:          int(nbtconv.Int16(m, "SpawnRange")),
+		RequiredPlayerRange: int(nbtconv.Int16(m, "RequiredPlayerRange")),
+		MaxNearbyEntities:   int(nbtconv.Int16(m, "MaxNearbyEntities")),
+	}, true
+}
+
+// Lectern is the block entity of a lectern.
+type Lectern struct {
+	// Book is the book on the lectern, or an empty stack if there is none.
+	Book item.Stack
+	// Page is the page the book is opened at, out of TotalPages.
+	Page, TotalPages int
+}
+
+// Lectern returns the lectern at the position passed. False is returned if there is no lectern block
+// entity at the position.
+func (w *World) Lectern(pos cube.Pos) (Lectern, bool) {
+	m, ok := w.blockEntityOf(pos, "Lectern")
+	if !ok {
+		return Lectern{}, false
+	}
+	l := Lectern{Page: int(nbtconv.Int32(m, "page")), TotalPages: int(nbtconv.Int32(m, "totalPages"))}
+	if nbtconv.Bool(m, "hasBook") {
+		l.Book = nbtconv.MapItem(m, "book")
+	}
+	return l, true
+}
+
+// Banner is the block entity of a standing or wall banner.
+type Banner struct {
+	Colour   item.Colour
+	Patterns []block.BannerPatternLayer
+	// Illager is true for the ominous banner carried by illagers.
+	Illager bool
+}
+
+// Banner returns the banner at the position passed. False is returned if there is no banner block entity
+// at the position.
+func (w *World) Banner(pos cube.Pos) (Banner, bool) {
+	m, ok := w.blockEntityOf(pos, "Banner")
+	if !ok {
+		return Banner{}, false
+	}
+	b := block.Banner{}.DecodeNBT(m).(block.Banner)
+	return Banner{Colour: b.Colour, Patterns: b.Patterns, Illager: b.Illager}, true
+}
+
+// BeehiveOccupant is a bee inside a beehive or bee nest.
+type BeehiveOccupant struct {
+	// EntityType is the identifier of the entity, usually minecraft:bee.
+	EntityType string
+	// TimeLeft is the time until the bee leaves the hive.
+	TimeLeft time.Duration
+	// Data holds the NBT of the entity.
+	Data map[string]any
+}
+
+// Beehive is the block entity of a beehive or bee nest.
+type Beehive struct {
+	Occupants []BeehiveOccupant
+}
+
+// Beehive returns the beehive or bee nest at the position passed. False is returned if there is no beehive
+// block entity at the position.
+func (w *World) Beehive(pos cube.Pos) (Beehive, bool) {
+	m, ok := w.blockEntityOf(pos, "Beehive")
+	if !ok {
+		return Beehive{}, false
+	}
+	var b Beehive
+	for _, o := range nbtconv.Slice(m, "Occupants") {
+		occupant, ok := o.(map[string]any)
+		if !ok {
+			continue
+		}
+		data, _ := occupant["SaveData"].(map[string]any)
+		b.Occupants = append(b.Occupants, BeehiveOccupant{
+			EntityType: nbtconv.String(occupant, "ActorIdentifier"),
+			TimeLeft:   nbtconv.TickDuration[int32](occupant, "TicksLeftToStay"),
+			Data:       data,
+		})
+	}
+	return b, true
+}
+
+// blockEntityOf returns a copy of the block entity at the position passed if its ID is any of the IDs
+// passed.
+func (w *World) blockEntityOf(pos cube.Pos, ids ...string) (map[string]any, bool) {
+	if w == nil || pos.OutOfBounds(w.r) {
+		return nil, false
+	}
+	c := w.Chunk(chunkPosFromBlockPos(pos))
+	if c == nil {
+		return nil, false
+	}
+	c.Lock()
+	defer c.Unlock()
+	m, ok := c.BlockEntities[pos]
+	if !ok || !slices.Contains(ids, nbtconv.String(m, "id")) {
+		return nil, false
+	}
+	// SetBlockEntity updates the map in place, so a copy is returned.
+	return maps.Clone(m), true
+}
+
+// containerItems decodes the Items of a container block entity with the size passed. Nil is returned if
+// the block entity holds no items.
+func containerItems(m map[string]any, size int) []item.Stack {
+	items := nbtconv.Slice(m, "Items")
+	if items == nil {
+		return nil
+	}
+	inv := inventory.New(size, nil)
+	nbtconv.InvFromNBT(inv, items)
+	return inv.Slots()
+}
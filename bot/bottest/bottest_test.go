@@ -0,0 +1,289 @@
+package bottest_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/df-mc/dragonfly/server/block"
+	"github.com/df-mc/dragonfly/server/block/cube"
+	"github.com/df-mc/dragonfly/server/item"
+	"github.com/df-mc/dragonfly/server/world"
+	"github.com/df-mc/dragonfly/server/world/chunk"
+	"github.com/go-gl/mathgl/mgl32"
+	"github.com/patyhank/bedrock-library/bot"
+	"github.com/patyhank/bedrock-library/bot/bottest"
+	"github.com/sandertv/gophertunnel/minecraft/protocol"
+	"github.com/sandertv/gophertunnel/minecraft/protocol/login"
+	"github.com/sandertv/gophertunnel/minecraft/protocol/packet"
+)
+
+// connect starts a server, connects a client to it and runs the client until the test ends.
+func connect(t *testing.T) (context.Context, *bot.Client, *bottest.Player) {
+	t.Helper()
+	return connectConfig(t, nil)
+}
+
+// connectConfig connects a client like connect, changing the config of the server with configure first if
+// it is not nil.
+func connectConfig(t *testing.T, configure func(config *bot.ClientConfig)) (context.Context, *bot.Client, *bottest.Player) {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*30)
+	t.Cleanup(cancel)
+
+	srv, err := bottest.NewServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = srv.Close() })
+
+	config := srv.Config()
+	if configure != nil {
+		configure(&config)
+	}
+	c, p, err := srv.ConnectConfig(ctx, bottest.DefaultGameData(), config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gameCtx, stop := context.WithCancel(ctx)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		_ = c.HandleGameContext(gameCtx)
+	}()
+	t.Cleanup(func() {
+		stop()
+		<-done
+	})
+	return ctx, c, p
+}
+
+func TestOpenContainer(t *testing.T) {
+	ctx, c, p := connect(t)
+	pos := protocol.BlockPos{2, 64, 0}
+
+	opened := make(chan error, 1)
+	go func() { opened <- c.OpenContainerContext(ctx, pos) }()
+
+	if _, err := bottest.Await(ctx, p, func(pk *packet.InventoryTransaction) bool {
+		data, ok := pk.TransactionData.(*protocol.UseItemTransactionData)
+		return ok && data.ActionType == protocol.UseItemActionClickBlock && data.BlockPosition == pos
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.OpenContainer(1, protocol.ContainerTypeContainer, pos); err != nil {
+		t.Fatal(err)
+	}
+	if err := <-opened; err != nil {
+		t.Fatal(err)
+	}
+	if !c.Screen.ContainerOpened.Load() {
+		t.Error("container not marked as opened")
+	}
+	if id := c.Screen.OpenedWindowID.Load(); id != 1 {
+		t.Errorf("opened window ID = %v, want 1", id)
+	}
+}
+
+func TestBreakBlock(t *testing.T) {
+	ctx, c, p := connect(t)
+	pos := cube.Pos{1, 64, 1}
+
+	air, _ := chunk.StateToRuntimeID("minecraft:air", nil)
+	ch := chunk.New(air, world.Overworld.Range())
+	ch.SetBlock(uint8(pos.X()), int16(pos.Y()), uint8(pos.Z()), 0, world.BlockRuntimeID(block.Dirt{}))
+	loaded := bot.Expect[*packet.LevelChunk](c, nil)
+	if err := p.SendChunk(world.ChunkPos{0, 0}, ch); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := loaded.Wait(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if b := c.World().Block(pos); b != (block.Dirt{}) {
+		t.Fatalf("block before breaking = %#v, want dirt", b)
+	}
+
+	broken := make(chan struct{})
+	go func() {
+		defer close(broken)
+		c.BreakBlock(pos)
+	}()
+
+	bPos := protocol.BlockPos{int32(pos.X()), int32(pos.Y()), int32(pos.Z())}
+	if _, err := bottest.Await(ctx, p, func(pk *packet.PlayerAction) bool {
+		return pk.ActionType == protocol.PlayerActionStartBreak && pk.BlockPosition == bPos
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.WritePacket(&packet.UpdateBlock{Position: bPos, NewBlockRuntimeID: air, Flags: packet.BlockUpdateNetwork}); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-broken:
+	case <-ctx.Done():
+		t.Fatal(ctx.Err())
+	}
+	if b := c.World().Block(pos); b != (block.Air{}) {
+		t.Errorf("block after breaking = %#v, want air", b)
+	}
+}
+
+func TestSendContainerClick(t *testing.T) {
+	ctx, c, p := connect(t)
+
+	stack := item.NewStack(item.Diamond{}, 3)
+	content := make([]protocol.ItemInstance, 36)
+	for i := range content {
+		content[i] = bot.InstanceFromItem(item.Stack{})
+	}
+	content[0] = protocol.ItemInstance{StackNetworkID: 1, Stack: bot.StackFromItem(stack)}
+	received := bot.Expect[*packet.InventoryContent](c, nil)
+	if err := p.SendInventory(protocol.WindowIDInventory, content); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := received.Wait(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	slot := func(i byte) protocol.StackRequestSlotInfo {
+		return protocol.StackRequestSlotInfo{
+			Container: protocol.FullContainerName{ContainerID: protocol.ContainerCombinedHotBarAndInventory},
+			Slot:      i,
+		}
+	}
+	request := c.Screen.PackingRequests(&protocol.SwapStackRequestAction{Source: slot(0), Destination: slot(1)})
+	if err := c.Screen.SendContainerClick(request); err != nil {
+		t.Fatal(err)
+	}
+
+	pk, err := bottest.Await[*packet.ItemStackRequest](ctx, p, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pk.Requests) != 1 || len(pk.Requests[0].Actions) != 1 {
+		t.Fatalf("received requests %#v, want a single action", pk.Requests)
+	}
+	swap, ok := pk.Requests[0].Actions[0].(*protocol.SwapStackRequestAction)
+	if !ok {
+		t.Fatalf("received action %T, want swap", pk.Requests[0].Actions[0])
+	}
+	if swap.Source.Slot != 0 || swap.Destination.Slot != 1 {
+		t.Errorf("swapped slots %v and %v, want 0 and 1", swap.Source.Slot, swap.Destination.Slot)
+	}
+	if it, _ := c.Screen.Inv.Item(1); !it.Comparable(stack) || it.Count() != stack.Count() {
+		t.Errorf("slot 1 after swap = %v, want %v", it, stack)
+	}
+	if it, _ := c.Screen.Inv.Item(0); !it.Empty() {
+		t.Errorf("slot 0 after swap = %v, want empty", it)
+	}
+}
+
+func TestForm(t *testing.T) {
+	ctx, c, p := connect(t)
+
+	forms := bot.ExpectEvent[*bot.Form](c, nil)
+	if err := p.SendForm(7, bot.Form{Type: "modal", Title: "Title", Content: "Content", ButtonYes: "Yes", ButtonNo: "No"}); err != nil {
+		t.Fatal(err)
+	}
+	form, err := forms.Wait(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if form.ID != 7 || form.Title != "Title" || form.ButtonYes != "Yes" {
+		t.Fatalf("received form %+v", form)
+	}
+
+	c.SendFormResponse("true")
+	response, err := bottest.Await[*packet.ModalFormResponse](ctx, p, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if response.FormID != 7 {
+		t.Errorf("response form ID = %v, want 7", response.FormID)
+	}
+	if data, ok := response.ResponseData.Value(); !ok || string(data) != "true" {
+		t.Errorf("response data = %q, want true", data)
+	}
+}
+
+func TestServerAddress(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*30)
+	defer cancel()
+	srv, err := bottest.NewServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Close()
+
+	config := srv.Config()
+	config.ClientData = &login.ClientData{ServerAddress: "10.0.0.1:19132"}
+	c, p, err := srv.ConnectConfig(ctx, bottest.DefaultGameData(), config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Disconnect("")
+	if addr := p.Conn().ClientData().ServerAddress; addr != config.ClientData.ServerAddress {
+		t.Errorf("server address = %v, want %v", addr, config.ClientData.ServerAddress)
+	}
+}
+
+func TestRespawn(t *testing.T) {
+	ctx, _, p := connectConfig(t, func(config *bot.ClientConfig) {
+		config.Respawn = &bot.RespawnPolicy{Delay: time.Millisecond, Command: "/back"}
+	})
+	rid := p.Conn().GameData().EntityRuntimeID
+	pos := mgl32.Vec3{8, 70, 8}
+
+	if err := p.WritePacket(&packet.ActorEvent{EntityRuntimeID: rid, EventType: packet.ActorEventDeath}); err != nil {
+		t.Fatal(err)
+	}
+	// The client sends a Respawn packet while spawning too, so the action is awaited first.
+	if _, err := bottest.Await(ctx, p, func(pk *packet.PlayerAction) bool {
+		return pk.ActionType == protocol.PlayerActionRespawn
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := bottest.Await(ctx, p, func(pk *packet.Respawn) bool {
+		return pk.State == packet.RespawnStateClientReadyToSpawn
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.WritePacket(&packet.SetHealth{Health: 20}); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.WritePacket(&packet.Respawn{Position: pos, State: packet.RespawnStateReadyToSpawn, EntityRuntimeID: rid}); err != nil {
+		t.Fatal(err)
+	}
+
+	// The inventory is opened and closed again, so that the server sends it.
+	if _, err := bottest.Await(ctx, p, func(pk *packet.Interact) bool {
+		return pk.ActionType == packet.InteractActionOpenInventory
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.WritePacket(&packet.ContainerOpen{WindowID: protocol.WindowIDInventory, ContainerEntityUniqueID: -1}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := bottest.Await(ctx, p, func(pk *packet.ContainerClose) bool {
+		return pk.WindowID == protocol.WindowIDInventory
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.CloseContainer(protocol.WindowIDInventory); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := bottest.Await[*packet.RequestChunkRadius](ctx, p, nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := bottest.Await(ctx, p, func(pk *packet.PlayerAuthInput) bool {
+		return pk.Position == pos
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := bottest.Await(ctx, p, func(pk *packet.CommandRequest) bool {
+		return pk.CommandLine == "/back"
+	}); err != nil {
+		t.Fatal(err)
+	}
+}
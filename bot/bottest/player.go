@@ -0,0 +1,159 @@
+package bottest
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+
+	"github.com/df-mc/dragonfly/server/world"
+	"github.com/df-mc/dragonfly/server/world/chunk"
+	"github.com/sandertv/gophertunnel/minecraft"
+	"github.com/sandertv/gophertunnel/minecraft/protocol"
+	"github.com/sandertv/gophertunnel/minecraft/protocol/packet"
+)
+
+// Player is the server side of the connection of a client to a Server.
+type Player struct {
+	s    *Server
+	conn *minecraft.Conn
+
+	mu       sync.Mutex
+	received []packet.Packet
+	// next is the index in received of the first packet not yet seen by Await.
+	next int
+	// notify is closed and replaced when a packet is received or the connection is closed.
+	notify chan struct{}
+	err    error
+}
+
+// newPlayer returns a Player for the connection passed and starts reading its packets.
+func newPlayer(s *Server, conn *minecraft.Conn) *Player {
+	p := &Player{s: s, conn: conn, notify: make(chan struct{})}
+	go p.read()
+	return p
+}
+
+// read reads packets from the client until the connection is closed.
+func (p *Player) read() {
+	for {
+		pk, err := p.conn.ReadPacket()
+		p.mu.Lock()
+		if err != nil {
+			p.err = err
+		} else {
+			p.received = append(p.received, pk)
+		}
+		close(p.notify)
+		p.notify = make(chan struct{})
+		p.mu.Unlock()
+		if err != nil {
+			return
+		}
+	}
+}
+
+// Conn returns the underlying connection.
+func (p *Player) Conn() *minecraft.Conn {
+	return p.conn
+}
+
+// Received returns all packets received from the client so far, including those skipped by Await.
+func (p *Player) Received() []packet.Packet {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]packet.Packet(nil), p.received...)
+}
+
+// WritePacket sends a packet to the client.
+func (p *Player) WritePacket(pk packet.Packet) error {
+	return p.conn.WritePacket(pk)
+}
+
+// Disconnect kicks the client with the message passed.
+func (p *Player) Disconnect(message string) error {
+	return p.s.listener.Disconnect(p.conn, message)
+}
+
+// Close closes the connection without a disconnect message.
+func (p *Player) Close() error {
+	return p.conn.Close()
+}
+
+// SendChunk sends the chunk passed at the position passed, encoded like a server that does not use sub
+// chunk requests.
+func (p *Player) SendChunk(pos world.ChunkPos, c *chunk.Chunk) error {
+	data := chunk.Encode(c, chunk.NetworkEncoding)
+	buf := bytes.NewBuffer(nil)
+	for _, sub := range data.SubChunks {
+		_, _ = buf.Write(sub)
+	}
+	_, _ = buf.Write(data.Biomes)
+	// Length of 1 byte for the border block count.
+	_ = buf.WriteByte(0)
+
+	return p.conn.WritePacket(&packet.LevelChunk{
+		Dimension:     p.conn.GameData().Dimension,
+		Position:      protocol.ChunkPos(pos),
+		SubChunkCount: uint32(len(data.SubChunks)),
+		RawPayload:    buf.Bytes(),
+	})
+}
+
+// SendInventory sends the full content of the window passed.
+func (p *Player) SendInventory(windowID uint32, items []protocol.ItemInstance) error {
+	return p.conn.WritePacket(&packet.InventoryContent{WindowID: windowID, Content: items})
+}
+
+// OpenContainer opens a container window of the type passed at the position passed.
+func (p *Player) OpenContainer(windowID, containerType byte, pos protocol.BlockPos) error {
+	return p.conn.WritePacket(&packet.ContainerOpen{
+		WindowID:                windowID,
+		ContainerType:           containerType,
+		ContainerPosition:       pos,
+		ContainerEntityUniqueID: -1,
+	})
+}
+
+// CloseContainer closes the container window passed.
+func (p *Player) CloseContainer(windowID byte) error {
+	return p.conn.WritePacket(&packet.ContainerClose{WindowID: windowID, ServerSide: true})
+}
+
+// SendForm sends a form with the ID passed. The form is encoded as JSON.
+func (p *Player) SendForm(formID uint32, form any) error {
+	data, err := json.Marshal(form)
+	if err != nil {
+		return fmt.Errorf("encode form: %w", err)
+	}
+	return p.conn.WritePacket(&packet.ModalFormRequest{FormID: formID, FormData: data})
+}
+
+// Await waits until the client sends a packet of type T for which predicate returns true, or ctx is done.
+// A nil predicate matches any packet of type T. Every call continues after the packet matched by the
+// previous one, and packets before the match, such as the PlayerAuthInput sent every tick, are skipped.
+func Await[T packet.Packet](ctx context.Context, p *Player, predicate func(T) bool) (T, error) {
+	var zero T
+	for {
+		p.mu.Lock()
+		for ; p.next < len(p.received); p.next++ {
+			if v, ok := p.received[p.next].(T); ok && (predicate == nil || predicate(v)) {
+				p.next++
+				p.mu.Unlock()
+				return v, nil
+			}
+		}
+		notify, err := p.notify, p.err
+		p.mu.Unlock()
+		if err != nil {
+			return zero, fmt.Errorf("await %T: %w", zero, err)
+		}
+
+		select {
+		case <-notify:
+		case <-ctx.Done():
+			return zero, ctx.Err()
+		}
+	}
+}
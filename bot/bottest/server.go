@@ -0,0 +1,151 @@
+// Package bottest runs a local Minecraft server without Xbox Live authentication in process, so that a
+// bot.Client can be tested end to end. The server plays a scripted session: a test accepts the client,
+// sends it packets such as chunks, inventories, containers and forms, and awaits what the client sends
+// back.
+//
+//	srv, _ := bottest.NewServer()
+//	defer srv.Close()
+//	c, p, _ := srv.Connect(ctx, bottest.DefaultGameData())
+//	go c.HandleGame()
+//	_ = p.OpenContainer(1, protocol.ContainerTypeContainer, protocol.BlockPos{0, 64, 0})
+//	_, _ = bottest.Await[*packet.ContainerClose](ctx, p, nil)
+package bottest
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/go-gl/mathgl/mgl32"
+	"github.com/patyhank/bedrock-library/bot"
+	"github.com/sandertv/gophertunnel/minecraft"
+	"github.com/sandertv/gophertunnel/minecraft/protocol"
+	"github.com/sandertv/gophertunnel/minecraft/protocol/packet"
+)
+
+// Server is a local Minecraft server clients connect to without authentication.
+type Server struct {
+	listener *minecraft.Listener
+}
+
+// NewServer starts a server listening on a random local port.
+func NewServer() (*Server, error) {
+	listener, err := minecraft.ListenConfig{
+		AuthenticationDisabled: true,
+		StatusProvider:         minecraft.NewStatusProvider("bottest", "bottest"),
+	}.Listen("raknet", "127.0.0.1:0")
+	if err != nil {
+		return nil, fmt.Errorf("listen: %w", err)
+	}
+	return &Server{listener: listener}, nil
+}
+
+// Addr returns the address the server listens on.
+func (s *Server) Addr() string {
+	return s.listener.Addr().String()
+}
+
+// Config returns a bot.ClientConfig to connect to the server with. It has no Token, so the client logs in
+// offline.
+func (s *Server) Config() bot.ClientConfig {
+	return bot.ClientConfig{Address: s.Addr()}
+}
+
+// Close stops the server and closes all connections.
+func (s *Server) Close() error {
+	return s.listener.Close()
+}
+
+// Accept waits for the next client to connect and starts the game with the data passed. It returns once
+// the client spawned.
+func (s *Server) Accept(ctx context.Context, data minecraft.GameData) (*Player, error) {
+	type result struct {
+		conn *minecraft.Conn
+		err  error
+	}
+	accepted := make(chan result, 1)
+	go func() {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			accepted <- result{err: err}
+			return
+		}
+		accepted <- result{conn: conn.(*minecraft.Conn)}
+	}()
+
+	var conn *minecraft.Conn
+	select {
+	case r := <-accepted:
+		if r.err != nil {
+			return nil, fmt.Errorf("accept: %w", r.err)
+		}
+		conn = r.conn
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	if err := conn.StartGameContext(ctx, data); err != nil {
+		_ = conn.Close()
+		return nil, fmt.Errorf("start game: %w", err)
+	}
+	return newPlayer(s, conn), nil
+}
+
+// Connect connects a new bot.Client to the server, attaches the bot.EventsListener and returns the client
+// together with its connection on the server side. The caller runs the client with HandleGame or Run.
+func (s *Server) Connect(ctx context.Context, data minecraft.GameData) (*bot.Client, *Player, error) {
+	return s.ConnectConfig(ctx, data, s.Config())
+}
+
+// ConnectConfig connects a new bot.Client like Connect, using the config passed, which should be based on
+// Config.
+func (s *Server) ConnectConfig(ctx context.Context, data minecraft.GameData, config bot.ClientConfig) (*bot.Client, *Player, error) {
+	type result struct {
+		p   *Player
+		err error
+	}
+	accepted := make(chan result, 1)
+	go func() {
+		p, err := s.Accept(ctx, data)
+		accepted <- result{p: p, err: err}
+	}()
+
+	c := bot.NewClient()
+	if err := c.ConnectToContext(ctx, config); err != nil {
+		return nil, nil, fmt.Errorf("connect: %w", err)
+	}
+	if err := (bot.EventsListener{}).AttachContext(ctx, c); err != nil {
+		_ = c.Conn.Close()
+		if r := <-accepted; r.p != nil {
+			_ = r.p.Close()
+		}
+		return nil, nil, fmt.Errorf("spawn: %w", err)
+	}
+
+	r := <-accepted
+	if r.err != nil {
+		_ = c.Conn.Close()
+		return nil, nil, r.err
+	}
+	return c, r.p, nil
+}
+
+// DefaultGameData returns the game data of a survival world in the overworld with the player spawned at
+// 0, 64, 0.
+func DefaultGameData() minecraft.GameData {
+	return minecraft.GameData{
+		WorldName:       "bottest",
+		Difficulty:      1,
+		EntityUniqueID:  1,
+		EntityRuntimeID: 1,
+		PlayerGameMode:  packet.GameTypeSurvival,
+		BaseGameVersion: protocol.CurrentVersion,
+		PlayerPosition:  mgl32.Vec3{0.5, 64 + 1.62, 0.5},
+		WorldSpawn:      protocol.BlockPos{0, 64, 0},
+		WorldGameMode:   packet.GameTypeSurvival,
+		Time:            6000,
+		PlayerMovementSettings: protocol.PlayerMovementSettings{
+			ServerAuthoritativeBlockBreaking: true,
+		},
+		PlayerPermissions: packet.PermissionLevelMember,
+		ChunkRadius:       8,
+	}
+}
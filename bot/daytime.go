@@ -0,0 +1,165 @@
+package bot
+
+import (
+	"math"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/df-mc/dragonfly/server/block/cube"
+	"github.com/sandertv/gophertunnel/minecraft/protocol"
+	"github.com/sandertv/gophertunnel/minecraft/protocol/packet"
+)
+
+// ticksPerDay is the length of a day in ticks.
+const ticksPerDay = 24000
+
+// levelTime tracks the time and weather of the level a client is in.
+type levelTime struct {
+	mu sync.Mutex
+	// time is the time of the level in ticks at the moment at.
+	time int64
+	at   time.Time
+	// daylightCycle is the doDaylightCycle game rule. If false, the time does not advance.
+	daylightCycle bool
+	// rain and thunder are the intensities of the weather, from 0 to 1.
+	rain, thunder float64
+}
+
+// weather holds the intensities of the weather, from 0 to 1.
+type weather struct {
+	rain, thunder float64
+}
+
+// reset resets the time and weather to the ones the client spawned with.
+func (l *levelTime) reset(t int64, rules []protocol.GameRule, w weather) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.time, l.at = t, time.Now()
+	l.daylightCycle = true
+	l.rain, l.thunder = w.rain, w.thunder
+	l.applyGameRules(rules)
+}
+
+// setTime sets the time of the level.
+func (l *levelTime) setTime(t int64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.time, l.at = t, time.Now()
+}
+
+// setGameRules applies the game rules relevant to time of a GameRulesChanged packet.
+func (l *levelTime) setGameRules(rules []protocol.GameRule) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.applyGameRules(rules)
+}
+
+// applyGameRules applies the game rules relevant to time. The mutex must be held.
+func (l *levelTime) applyGameRules(rules []protocol.GameRule) {
+	for _, rule := range rules {
+		if !strings.EqualFold(rule.Name, "doDaylightCycle") {
+			continue
+		}
+		if v, ok := rule.Value.(bool); ok {
+			// Freeze the time at its current value, or continue from it.
+			l.time, l.at = l.now(), time.Now()
+			l.daylightCycle = v
+		}
+	}
+}
+
+// applyLevelEvent applies the weather change of the LevelEvent passed.
+func (l *levelTime) applyLevelEvent(p *packet.LevelEvent) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	// The intensity of the weather is sent as a value from 0 to 65535.
+	intensity := min(float64(p.EventData)/65535, 1)
+	switch p.EventType {
+	case packet.LevelEventStartRaining:
+		l.rain = max(intensity, 0.01)
+	case packet.LevelEventStopRaining:
+		l.rain = 0
+	case packet.LevelEventStartThunderstorm:
+		l.thunder = max(intensity, 0.01)
+	case packet.LevelEventStopThunderstorm:
+		l.thunder = 0
+	}
+}
+
+// now returns the current time of the level in ticks. The mutex must be held.
+func (l *levelTime) now() int64 {
+	if !l.daylightCycle {
+		return l.time
+	}
+	return l.time + time.Since(l.at).Milliseconds()/50
+}
+
+// Time returns the time of the level in ticks, counting from the creation of the world. The time is
+// advanced locally between updates of the server.
+func (c *Client) Time() int64 {
+	c.levelTime.mu.Lock()
+	defer c.levelTime.mu.Unlock()
+	return c.levelTime.now()
+}
+
+// TimeOfDay returns the time of the current day in ticks, from 0 to 23999. 0 is sunrise, 6000 is noon,
+// 12000 is sunset and 18000 is midnight.
+func (c *Client) TimeOfDay() int {
+	return int(((c.Time() % ticksPerDay) + ticksPerDay) % ticksPerDay)
+}
+
+// IsNight checks if it is night, during which hostile mobs may spawn under the open sky.
+func (c *Client) IsNight() bool {
+	t := c.TimeOfDay()
+	return t >= 13000 && t < 23000
+}
+
+// IsRaining checks if it is raining, or snowing in cold biomes.
+func (c *Client) IsRaining() bool {
+	c.levelTime.mu.Lock()
+	defer c.levelTime.mu.Unlock()
+	return c.levelTime.rain > 0
+}
+
+// IsThundering checks if there is a thunderstorm.
+func (c *Client) IsThundering() bool {
+	c.levelTime.mu.Lock()
+	defer c.levelTime.mu.Unlock()
+	return c.levelTime.thunder > 0
+}
+
+// SkyDarkening returns the number of light levels the sky light is dimmed by because of the time of day
+// and the weather, from 0 at noon to 11 at midnight.
+func (c *Client) SkyDarkening() uint8 {
+	c.levelTime.mu.Lock()
+	t, rain, thunder := c.levelTime.now(), c.levelTime.rain, c.levelTime.thunder
+	c.levelTime.mu.Unlock()
+
+	// The angle of the sun, where 0 is noon and 0.5 midnight.
+	angle := float64(((t%ticksPerDay)+ticksPerDay)%ticksPerDay)/ticksPerDay - 0.25
+	if angle < 0 {
+		angle++
+	}
+	angle += ((1 - (math.Cos(angle*math.Pi)+1)/2) - angle) / 3
+
+	brightness := min(max(math.Cos(angle*math.Pi*2)*2+0.5, 0), 1)
+	brightness *= 1 - rain*5/16
+	brightness *= 1 - thunder*5/16
+	return uint8((1 - brightness) * 11)
+}
+
+// EffectiveLight returns the light level at the position passed in the World of the client, with the sky
+// light dimmed by the time of day and the weather.
+func (c *Client) EffectiveLight(pos cube.Pos) uint8 {
+	w := c.World()
+	sky := int(w.SkyLight(pos)) - int(c.SkyDarkening())
+	return uint8(max(int(w.BlockLight(pos)), sky, 0))
+}
+
+// HostileSpawnable checks if the light at the position passed is low enough for hostile mobs to spawn
+// there: no block light and an effective light level of at most 7. Whether the block below allows spawning
+// is not checked.
+func (c *Client) HostileSpawnable(pos cube.Pos) bool {
+	return c.World().BlockLight(pos) == 0 && c.EffectiveLight(pos) <= 7
+}
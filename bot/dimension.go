@@ -0,0 +1,130 @@
+package bot
+
+import (
+	"github.com/df-mc/dragonfly/server/block/cube"
+	"github.com/df-mc/dragonfly/server/world"
+	"github.com/sandertv/gophertunnel/minecraft/protocol"
+	"github.com/sandertv/gophertunnel/minecraft/protocol/packet"
+)
+
+// dimensionID returns the ID of the dimension with the name passed, as used in a DimensionData packet.
+func dimensionID(name string) (int, bool) {
+	switch name {
+	case "minecraft:overworld":
+		return packet.DimensionOverworld, true
+	case "minecraft:nether":
+		return packet.DimensionNether, true
+	case "minecraft:the_end":
+		return packet.DimensionEnd, true
+	}
+	return 0, false
+}
+
+// dimensionRange returns the height range of the dimension passed. Ranges sent by the server in a
+// DimensionData packet take precedence over the vanilla ranges. Unknown dimensions get the range of the
+// overworld.
+func (e *EventsListener) dimensionRange(dimension int) cube.Range {
+	if r, ok := e.dimensionData[dimension]; ok {
+		return r
+	}
+	if dim, ok := world.DimensionByID(dimension); ok {
+		return dim.Range()
+	}
+	return world.Overworld.Range()
+}
+
+// dimension returns the ID of the dimension the client is in.
+func (e *EventsListener) dimension() int {
+	return int(e.currentDimension.Load())
+}
+
+// completeDimensionChange completes the dimension change in progress once the client spawned in the new
+// dimension, and publishes a DimensionChangedEvent.
+func (e *EventsListener) completeDimensionChange(c *Client) error {
+	change := e.dimensionChange
+	e.dimensionChange = nil
+	if err := c.WritePacket(&packet.PlayerAction{
+		EntityRuntimeID: c.Self.EntityRuntimeID,
+		ActionType:      protocol.PlayerActionDimensionChangeDone,
+	}); err != nil {
+		return err
+	}
+	if err := c.WritePacket(&packet.ServerBoundLoadingScreen{
+		Type:            packet.LoadingScreenTypeEnd,
+		LoadingScreenID: e.loadingScreenID,
+	}); err != nil {
+		return err
+	}
+	publishEvent(c, change)
+	return nil
+}
+
+// Dimension returns the ID of the dimension the client is in.
+func (c *Client) Dimension() int {
+	if c.listener != nil {
+		return c.listener.dimension()
+	}
+	if c.conn != nil {
+		return int(c.conn.GameData().Dimension)
+	}
+	return 0
+}
+
+// WorldFor returns the World of the dimension passed, or nil if the client was not in the dimension during
+// the current session. Worlds of other dimensions keep the columns the client last used in them, up to
+// 16 MiB of them unless the WorldMemoryLimit is lower.
+func (c *Client) WorldFor(dimension int) *World {
+	c.worldsMu.Lock()
+	defer c.worldsMu.Unlock()
+	return c.worlds[dimension]
+}
+
+// worldFor returns the World of the dimension passed, creating it if the client was not in the dimension
+// yet or if the height range of the dimension changed.
+func (c *Client) worldFor(dimension int, r cube.Range) *World {
+	c.worldsMu.Lock()
+	defer c.worldsMu.Unlock()
+	if w, ok := c.worlds[dimension]; ok && w.Range() == r {
+		return w
+	}
+	if c.worlds == nil {
+		c.worlds = map[int]*World{}
+	}
+	w := c.newWorld(dimension, r)
+	c.worlds[dimension] = w
+	return w
+}
+
+// allWorlds returns the World of every dimension the client was in during the session.
+func (c *Client) allWorlds() []*World {
+	c.worldsMu.Lock()
+	defer c.worldsMu.Unlock()
+	worlds := make([]*World, 0, len(c.worlds))
+	for _, w := range c.worlds {
+		worlds = append(worlds, w)
+	}
+	return worlds
+}
+
+// removeViews removes the chunk view of the client from all its worlds once its session ended, so that
+// the columns of worlds shared with other clients are evicted without it, and evicts the columns no longer
+// needed.
+func (c *Client) removeViews() {
+	for _, w := range c.allWorlds() {
+		w.removeView(c)
+		if c.listener != nil {
+			c.listener.evict(c, w)
+		}
+	}
+}
+
+// resetWorlds forgets the worlds of the previous session.
+func (c *Client) resetWorlds() {
+	c.worldsMu.Lock()
+	defer c.worldsMu.Unlock()
+	for _, w := range c.worlds {
+		w.removeView(c)
+	}
+	c.worlds = nil
+	c.world = nil
+}
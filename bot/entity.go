@@ -1,11 +1,11 @@
 package bot
 
 import (
+	"github.com/df-mc/dragonfly/server/world"
 	"github.com/go-gl/mathgl/mgl32"
 	"github.com/google/uuid"
 	"github.com/sandertv/gophertunnel/minecraft/protocol"
 	"github.com/sandertv/gophertunnel/minecraft/protocol/packet"
-	"golang.org/x/exp/maps"
 	"sync"
 )
 
@@ -46,11 +46,11 @@ type Entity struct {
 	BodyYaw float32
 	// Attributes is a slice of attributes that the entity has. It includes attributes such as its health,
 	// movement speed, etc.
-	Attributes []protocol.AttributeValue
+	Attributes Attributes
 	// EntityMetadata is a map of entity metadata, which includes flags and data properties that alter in
 	// particular the way the entity looks. Flags include ones such as 'on fire' and 'sprinting'.
 	// The metadata values are indexed by their property key.
-	EntityMetadata map[uint32]any
+	EntityMetadata Metadata
 	// EntityProperties is a list of properties that the entity inhibits. These properties define and alter specific
 	// attributes of the entity.
 	EntityProperties protocol.EntityProperties
@@ -58,6 +58,11 @@ type Entity struct {
 	// way the entity shows up when first spawned in terms of it shown as riding an entity. Setting these
 	// links is important for new viewers to see the entity is riding another entity.
 	EntityLinks []protocol.EntityLink
+	// Equipment holds the items the entity is holding and wearing.
+	Equipment Equipment
+	// Painting holds the title and direction of the painting if the entity is a painting, and is nil
+	// otherwise.
+	Painting *Painting
 }
 
 type Player struct {
@@ -69,6 +74,8 @@ type Player struct {
 	// Username is the name of the player. This username is the username that will be set as the initial
 	// name tag of the player.
 	Username string
+	// EntityUniqueID is the unique ID of the player.
+	EntityUniqueID int64
 	// EntityRuntimeID is the runtime ID of the player. The runtime ID is unique for each world session, and
 	// entities are generally identified in packets using this runtime ID.
 	EntityRuntimeID uint64
@@ -84,12 +91,16 @@ type Player struct {
 	// itself shows up. Needless to say that this field is rather pointless, as additional packets still must
 	// be sent for Armour to show up.
 	HeldItem protocol.ItemInstance
+	// Equipment holds the items the player is holding and wearing.
+	Equipment Equipment
 	// GameType is the game type of the player. If set to GameTypeSpectator, the player will not be shown to viewers.
 	GameType int32
+	// Attributes holds the attributes of the player, such as its health.
+	Attributes Attributes
 	// EntityMetadata is a map of entity metadata, which includes flags and data properties that alter in
 	// particular the way the player looks. Flags include ones such as 'on fire' and 'sprinting'.
 	// The metadata values are indexed by their property key.
-	EntityMetadata map[uint32]any
+	EntityMetadata Metadata
 	// EntityProperties is a list of properties that the entity inhibits. These properties define and alter specific
 	// attributes of the entity.
 	EntityProperties protocol.EntityProperties
@@ -125,90 +136,131 @@ type ItemEntity struct {
 	// EntityMetadata is a map of entity metadata, which includes flags and data properties that alter in
 	// particular the way the entity looks. Flags include ones such as 'on fire' and 'sprinting'.
 	// The metadata values are indexed by their property key.
-	EntityMetadata map[uint32]any
+	EntityMetadata Metadata
 	// FromFishing specifies if the item was obtained by fishing it up using a fishing rod. It is not clear
 	// why the client needs to know this.
 	FromFishing bool
 }
 
+// EntityManager tracks the entities, players and items in view of the client. All methods are safe for
+// concurrent use. Entities returned are copies, so they are not updated after they were returned.
 type EntityManager struct {
-	pMutex   sync.Mutex
+	mu       sync.Mutex
 	players  map[uint64]*Player
-	eMutex   sync.Mutex
 	entities map[uint64]*Entity
 	items    map[uint64]*ItemEntity
-	iMutex   sync.Mutex
+	// uniqueIDs maps the unique ID of every entity to its runtime ID.
+	uniqueIDs map[int64]uint64
+	// chunks is the spatial index of the entities, holding the runtime IDs of the entities in every chunk.
+	// chunkOf holds the chunk every entity is in.
+	chunks  map[world.ChunkPos]map[uint64]struct{}
+	chunkOf map[uint64]world.ChunkPos
 }
 
 func NewEntityManager() *EntityManager {
 	return &EntityManager{
-		players:  make(map[uint64]*Player),
-		pMutex:   sync.Mutex{},
-		entities: make(map[uint64]*Entity),
-		eMutex:   sync.Mutex{},
-		items:    make(map[uint64]*ItemEntity),
-		iMutex:   sync.Mutex{},
+		players:   make(map[uint64]*Player),
+		entities:  make(map[uint64]*Entity),
+		items:     make(map[uint64]*ItemEntity),
+		uniqueIDs: make(map[int64]uint64),
+		chunks:    make(map[world.ChunkPos]map[uint64]struct{}),
+		chunkOf:   make(map[uint64]world.ChunkPos),
 	}
 }
-func (n *EntityManager) MoveEntity(pkData *packet.MoveActorAbsolute) {
-	rID := pkData.EntityRuntimeID
-	var ent *Positioner
-	if entity := n.GetEntity(rID); entity != nil {
-		n.eMutex.Lock()
-		defer n.eMutex.Unlock()
-		ent = entity.Positioner
-	}
-	if entity := n.GetItem(rID); entity != nil {
-		n.iMutex.Lock()
-		defer n.iMutex.Unlock()
-		ent = entity.Positioner
-	}
-	if entity := n.GetPlayer(rID); entity != nil {
-		n.pMutex.Lock()
-		defer n.pMutex.Unlock()
-		ent = entity.Positioner
+
+// positioner returns the Positioner of the entity with the runtime ID passed, or nil if the entity is not
+// known. The mutex must be held.
+func (n *EntityManager) positioner(rID uint64) *Positioner {
+	if e, ok := n.entities[rID]; ok {
+		return e.Positioner
+	}
+	if p, ok := n.players[rID]; ok {
+		return p.Positioner
+	}
+	if i, ok := n.items[rID]; ok {
+		return i.Positioner
 	}
+	return nil
+}
+
+func (n *EntityManager) MoveEntity(pkData *packet.MoveActorAbsolute) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	ent := n.positioner(pkData.EntityRuntimeID)
 	if ent == nil {
 		return
 	}
 	ent.Position = pkData.Position
-	ent.Pitch = pkData.Position[0]
-	ent.Yaw = pkData.Position[1]
-	ent.HeadYaw = pkData.Position[2]
+	ent.Pitch = pkData.Rotation[0]
+	ent.Yaw = pkData.Rotation[1]
+	ent.HeadYaw = pkData.Rotation[2]
+	ent.OnGround = pkData.Flags&packet.MoveFlagOnGround != 0
+	n.index(pkData.EntityRuntimeID, ent.Position)
 }
 func (n *EntityManager) MovePlayer(pkData *packet.MovePlayer) {
-	if entity := n.GetPlayer(pkData.EntityRuntimeID); entity != nil {
-		n.pMutex.Lock()
-		defer n.pMutex.Unlock()
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if entity, ok := n.players[pkData.EntityRuntimeID]; ok {
 		ent := entity.Positioner
 
 		ent.Position = pkData.Position
-		ent.Pitch = pkData.Position[0]
-		ent.Yaw = pkData.Position[1]
-		ent.HeadYaw = pkData.Position[2]
+		ent.Pitch = pkData.Pitch
+		ent.Yaw = pkData.Yaw
+		ent.HeadYaw = pkData.HeadYaw
+		ent.OnGround = pkData.OnGround
+		n.index(pkData.EntityRuntimeID, ent.Position)
 	}
 }
-func (n *EntityManager) RemoveEntity(rID int64) {
-	if entity := n.GetEntity(uint64(rID)); entity != nil {
-		n.eMutex.Lock()
-		defer n.eMutex.Unlock()
-		delete(n.entities, uint64(rID))
-	}
-	if entity := n.GetItem(uint64(rID)); entity != nil {
-		n.iMutex.Lock()
-		defer n.iMutex.Unlock()
-		delete(n.items, uint64(rID))
+
+// RemoveEntity removes the entity, player or item with the unique ID passed, as sent in a RemoveActor
+// packet.
+func (n *EntityManager) RemoveEntity(uID int64) {
+	n.remove(uID)
+}
+
+// remove removes the entity with the unique ID passed and returns its runtime ID and type. False is
+// returned if no entity with the unique ID is known.
+func (n *EntityManager) remove(uID int64) (rID uint64, entityType string, ok bool) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	rID, ok = n.uniqueIDs[uID]
+	if !ok {
+		return 0, "", false
 	}
-	if entity := n.GetPlayer(uint64(rID)); entity != nil {
-		n.pMutex.Lock()
-		defer n.pMutex.Unlock()
-		delete(n.players, uint64(rID))
+	delete(n.uniqueIDs, uID)
+	return rID, n.removeRuntimeID(rID), true
+}
+
+// removeRuntimeID removes the entity with the runtime ID passed from all maps and returns its type. The
+// mutex must be held.
+func (n *EntityManager) removeRuntimeID(rID uint64) string {
+	var entityType string
+	if e, ok := n.entities[rID]; ok {
+		entityType = e.EntityType
+	} else if _, ok := n.players[rID]; ok {
+		entityType = "minecraft:player"
+	} else if _, ok := n.items[rID]; ok {
+		entityType = "minecraft:item"
 	}
+	delete(n.entities, rID)
+	delete(n.players, rID)
+	delete(n.items, rID)
+	n.unindex(rID)
+	return entityType
+}
+
+// add registers the unique ID and position of an entity added, replacing any entity with the same runtime
+// ID. The mutex must be held.
+func (n *EntityManager) add(uID int64, rID uint64, pos mgl32.Vec3) {
+	n.removeRuntimeID(rID)
+	n.uniqueIDs[uID] = rID
+	n.index(rID, pos)
 }
 
 func (n *EntityManager) AddEntity(actor *packet.AddActor) {
-	n.eMutex.Lock()
-	defer n.eMutex.Unlock()
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.add(actor.EntityUniqueID, actor.EntityRuntimeID, actor.Position)
 	n.entities[actor.EntityRuntimeID] = &Entity{
 		Positioner: &Positioner{
 			Position: actor.Position,
@@ -228,9 +280,25 @@ func (n *EntityManager) AddEntity(actor *packet.AddActor) {
 		EntityLinks:      actor.EntityLinks,
 	}
 }
+
+// AddPainting adds a painting as an Entity of the type minecraft:painting.
+func (n *EntityManager) AddPainting(actor *packet.AddPainting) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.add(actor.EntityUniqueID, actor.EntityRuntimeID, actor.Position)
+	n.entities[actor.EntityRuntimeID] = &Entity{
+		Positioner:      &Positioner{Position: actor.Position},
+		EntityUniqueID:  actor.EntityUniqueID,
+		EntityRuntimeID: actor.EntityRuntimeID,
+		EntityType:      "minecraft:painting",
+		EntityMetadata:  Metadata{},
+		Painting:        &Painting{Title: actor.Title, Direction: actor.Direction},
+	}
+}
 func (n *EntityManager) AddItems(actor *packet.AddItemActor) {
-	n.iMutex.Lock()
-	defer n.iMutex.Unlock()
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.add(actor.EntityUniqueID, actor.EntityRuntimeID, actor.Position)
 	n.items[actor.EntityRuntimeID] = &ItemEntity{
 		Positioner: &Positioner{
 			Position: actor.Position,
@@ -245,8 +313,9 @@ func (n *EntityManager) AddItems(actor *packet.AddItemActor) {
 	}
 }
 func (n *EntityManager) AddPlayer(actor *packet.AddPlayer) {
-	n.pMutex.Lock()
-	defer n.pMutex.Unlock()
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.add(actor.AbilityData.EntityUniqueID, actor.EntityRuntimeID, actor.Position)
 	n.players[actor.EntityRuntimeID] = &Player{
 		Positioner: &Positioner{
 			Position: actor.Position,
@@ -257,10 +326,12 @@ func (n *EntityManager) AddPlayer(actor *packet.AddPlayer) {
 		},
 		UUID:             actor.UUID,
 		Username:         actor.Username,
+		EntityUniqueID:   actor.AbilityData.EntityUniqueID,
 		EntityRuntimeID:  actor.EntityRuntimeID,
 		PlatformChatID:   actor.PlatformChatID,
 		Velocity:         actor.Velocity,
 		HeldItem:         actor.HeldItem,
+		Equipment:        Equipment{MainHand: actor.HeldItem},
 		GameType:         actor.GameType,
 		EntityMetadata:   actor.EntityMetadata,
 		EntityProperties: actor.EntityProperties,
@@ -272,23 +343,9 @@ func (n *EntityManager) AddPlayer(actor *packet.AddPlayer) {
 }
 
 func (n *EntityManager) MoveEntityDel(pkData *packet.MoveActorDelta) {
-	rID := pkData.EntityRuntimeID
-	var ent *Positioner
-	if entity := n.GetEntity(rID); entity != nil {
-		n.eMutex.Lock()
-		defer n.eMutex.Unlock()
-		ent = entity.Positioner
-	}
-	if entity := n.GetItem(rID); entity != nil {
-		n.iMutex.Lock()
-		defer n.iMutex.Unlock()
-		ent = entity.Positioner
-	}
-	if entity := n.GetPlayer(rID); entity != nil {
-		n.pMutex.Lock()
-		defer n.pMutex.Unlock()
-		ent = entity.Positioner
-	}
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	ent := n.positioner(pkData.EntityRuntimeID)
 	if ent == nil {
 		return
 	}
@@ -307,43 +364,175 @@ func (n *EntityManager) MoveEntityDel(pkData *packet.MoveActorDelta) {
 	if pkData.Flags&packet.MoveActorDeltaFlagHasRotY != 0 {
 		ent.Yaw = pkData.Rotation.Y()
 	}
-	if pkData.Flags&packet.MoveActorDeltaFlagHasZ != 0 {
+	if pkData.Flags&packet.MoveActorDeltaFlagHasRotZ != 0 {
 		ent.HeadYaw = pkData.Rotation.Z()
 	}
+	ent.OnGround = pkData.Flags&packet.MoveActorDeltaFlagOnGround != 0
+	n.index(pkData.EntityRuntimeID, ent.Position)
+}
+
+// SetMetadata merges the metadata of a SetActorData packet into the metadata of the entity.
+func (n *EntityManager) SetMetadata(pkData *packet.SetActorData) {
+	n.setMetadata(pkData)
+}
+
+// setMetadata merges the metadata of a SetActorData packet into the metadata of the entity and returns the
+// metadata before and after. False is returned if the entity is not known.
+func (n *EntityManager) setMetadata(pkData *packet.SetActorData) (old, new Metadata, ok bool) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	// Metadata maps are never modified once stored, so copies of entities may share them.
+	if e, ok := n.entities[pkData.EntityRuntimeID]; ok {
+		old, e.EntityMetadata = e.EntityMetadata, e.EntityMetadata.merge(pkData.EntityMetadata)
+		e.EntityProperties = pkData.EntityProperties
+		return old, e.EntityMetadata, true
+	}
+	if p, ok := n.players[pkData.EntityRuntimeID]; ok {
+		old, p.EntityMetadata = p.EntityMetadata, p.EntityMetadata.merge(pkData.EntityMetadata)
+		p.EntityProperties = pkData.EntityProperties
+		return old, p.EntityMetadata, true
+	}
+	if i, ok := n.items[pkData.EntityRuntimeID]; ok {
+		old, i.EntityMetadata = i.EntityMetadata, i.EntityMetadata.merge(pkData.EntityMetadata)
+		return old, i.EntityMetadata, true
+	}
+	return nil, nil, false
+}
+
+// SetAttributes updates the attributes of the entity or player of an UpdateAttributes packet.
+func (n *EntityManager) SetAttributes(pkData *packet.UpdateAttributes) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if e, ok := n.entities[pkData.EntityRuntimeID]; ok {
+		e.Attributes = e.Attributes.apply(pkData.Attributes)
+	}
+	if p, ok := n.players[pkData.EntityRuntimeID]; ok {
+		p.Attributes = p.Attributes.apply(pkData.Attributes)
+	}
+}
+
+// SetMotion sets the velocity of the entity of a SetActorMotion packet.
+func (n *EntityManager) SetMotion(pkData *packet.SetActorMotion) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if e, ok := n.entities[pkData.EntityRuntimeID]; ok {
+		e.Velocity = pkData.Velocity
+	}
+	if p, ok := n.players[pkData.EntityRuntimeID]; ok {
+		p.Velocity = pkData.Velocity
+	}
+	if i, ok := n.items[pkData.EntityRuntimeID]; ok {
+		i.Velocity = pkData.Velocity
+	}
+}
+
+// SetLink adds or removes the link of a SetActorLink packet to or from both the rider and the entity
+// ridden.
+func (n *EntityManager) SetLink(pkData *packet.SetActorLink) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	for _, uID := range []int64{pkData.EntityLink.RiddenEntityUniqueID, pkData.EntityLink.RiderEntityUniqueID} {
+		rID, ok := n.uniqueIDs[uID]
+		if !ok {
+			continue
+		}
+		if e, ok := n.entities[rID]; ok {
+			e.EntityLinks = applyLink(e.EntityLinks, pkData.EntityLink)
+		}
+		if p, ok := n.players[rID]; ok {
+			p.EntityLinks = applyLink(p.EntityLinks, pkData.EntityLink)
+		}
+	}
+}
+
+// SetEquipment sets the item held in the main hand or off hand by the entity of a MobEquipment packet.
+func (n *EntityManager) SetEquipment(pkData *packet.MobEquipment) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	var eq *Equipment
+	if e, ok := n.entities[pkData.EntityRuntimeID]; ok {
+		eq = &e.Equipment
+	} else if p, ok := n.players[pkData.EntityRuntimeID]; ok {
+		eq = &p.Equipment
+		if pkData.WindowID != protocol.WindowIDOffHand {
+			p.HeldItem = pkData.NewItem
+		}
+	} else {
+		return
+	}
+	if pkData.WindowID == protocol.WindowIDOffHand {
+		eq.OffHand = pkData.NewItem
+		return
+	}
+	eq.MainHand = pkData.NewItem
+}
+
+// SetArmour sets the armour worn by the entity of a MobArmourEquipment packet.
+func (n *EntityManager) SetArmour(pkData *packet.MobArmourEquipment) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	var eq *Equipment
+	if e, ok := n.entities[pkData.EntityRuntimeID]; ok {
+		eq = &e.Equipment
+	} else if p, ok := n.players[pkData.EntityRuntimeID]; ok {
+		eq = &p.Equipment
+	} else {
+		return
+	}
+	eq.Armour = [4]protocol.ItemInstance{pkData.Helmet, pkData.Chestplate, pkData.Leggings, pkData.Boots}
+	eq.Body = pkData.Body
 }
 
 func (n *EntityManager) GetPlayers() map[uint64]*Player {
-	n.pMutex.Lock()
-	data := maps.Clone(n.players)
-	n.pMutex.Unlock()
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	data := make(map[uint64]*Player, len(n.players))
+	for rID, p := range n.players {
+		data[rID] = p.clone()
+	}
 	return data
 }
 func (n *EntityManager) GetEntities() map[uint64]*Entity {
-	n.eMutex.Lock()
-	data := maps.Clone(n.entities)
-	n.eMutex.Unlock()
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	data := make(map[uint64]*Entity, len(n.entities))
+	for rID, e := range n.entities {
+		data[rID] = e.clone()
+	}
 	return data
 }
 func (n *EntityManager) GetItems() map[uint64]*ItemEntity {
-	n.iMutex.Lock()
-	data := maps.Clone(n.items)
-	n.iMutex.Unlock()
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	data := make(map[uint64]*ItemEntity, len(n.items))
+	for rID, i := range n.items {
+		data[rID] = i.clone()
+	}
 	return data
 }
 func (n *EntityManager) GetPlayer(rID uint64) *Player {
-	n.pMutex.Lock()
-	defer n.pMutex.Unlock()
-	return n.players[rID]
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.players[rID].clone()
 }
 func (n *EntityManager) GetEntity(rID uint64) *Entity {
-	n.eMutex.Lock()
-	defer n.eMutex.Unlock()
-	return n.entities[rID]
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.entities[rID].clone()
+}
+
+// RuntimeID returns the runtime ID of the entity with the unique ID passed. False is returned if no entity
+// with the unique ID is known.
+func (n *EntityManager) RuntimeID(uID int64) (uint64, bool) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	rID, ok := n.uniqueIDs[uID]
+	return rID, ok
 }
 
 func AttackEntity(client *Client, e *Entity) {
 	if DistanceToVec3(e.Position, client.Self.Position) <= 6 {
-		client.Conn.WritePacket(&packet.Interact{
+		client.WritePacket(&packet.Interact{
 			TargetEntityRuntimeID: e.EntityRuntimeID,
 			ActionType:            2,
 		})
@@ -351,7 +540,7 @@ func AttackEntity(client *Client, e *Entity) {
 }
 func InteractEntity(client *Client, e *Entity) {
 	if DistanceToVec3(e.Position, client.Self.Position) <= 4 {
-		client.Conn.WritePacket(&packet.InventoryTransaction{
+		client.WritePacket(&packet.InventoryTransaction{
 			TransactionData: &protocol.UseItemOnEntityTransactionData{
 				TargetEntityRuntimeID: e.EntityRuntimeID,
 				ActionType:            protocol.UseItemOnEntityActionInteract,
@@ -363,7 +552,7 @@ func InteractEntity(client *Client, e *Entity) {
 }
 func AttackPlayer(client *Client, e *Player) {
 	if DistanceToVec3(e.Position, client.Self.Position) <= 6 {
-		client.Conn.WritePacket(&packet.Interact{
+		client.WritePacket(&packet.Interact{
 			TargetEntityRuntimeID: e.EntityRuntimeID,
 			ActionType:            2,
 		})
@@ -371,7 +560,45 @@ func AttackPlayer(client *Client, e *Player) {
 }
 
 func (n *EntityManager) GetItem(rID uint64) *ItemEntity {
-	n.iMutex.Lock()
-	defer n.iMutex.Unlock()
-	return n.items[rID]
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.items[rID].clone()
+}
+
+// clone returns a copy of the entity, or nil if the entity is nil. Metadata, attributes and links are
+// replaced rather than modified when updated, so they are shared with the copy.
+func (e *Entity) clone() *Entity {
+	if e == nil {
+		return nil
+	}
+	c := *e
+	pos := *e.Positioner
+	c.Positioner = &pos
+	if e.Painting != nil {
+		painting := *e.Painting
+		c.Painting = &painting
+	}
+	return &c
+}
+
+// clone returns a copy of the player, or nil if the player is nil.
+func (p *Player) clone() *Player {
+	if p == nil {
+		return nil
+	}
+	c := *p
+	pos := *p.Positioner
+	c.Positioner = &pos
+	return &c
+}
+
+// clone returns a copy of the item entity, or nil if the item entity is nil.
+func (i *ItemEntity) clone() *ItemEntity {
+	if i == nil {
+		return nil
+	}
+	c := *i
+	pos := *i.Positioner
+	c.Positioner = &pos
+	return &c
 }
@@ -0,0 +1,298 @@
+package bot
+
+import (
+	"cmp"
+	"math"
+	"slices"
+
+	"github.com/df-mc/dragonfly/server/block/cube"
+	"github.com/df-mc/dragonfly/server/world"
+	"github.com/go-gl/mathgl/mgl32"
+	"github.com/sandertv/gophertunnel/minecraft/protocol"
+)
+
+// EntitySnapshot is a copy of the state of an entity, player or item tracked by the EntityManager at the
+// moment it was queried.
+type EntitySnapshot struct {
+	Positioner
+	EntityRuntimeID uint64
+	EntityUniqueID  int64
+	// EntityType is the type of the entity, minecraft:player for players and minecraft:item for items.
+	EntityType string
+	// Name is the username of players and the name tag of other entities.
+	Name           string
+	Velocity       mgl32.Vec3
+	EntityMetadata Metadata
+	Attributes     Attributes
+	Equipment      Equipment
+	EntityLinks    []protocol.EntityLink
+
+	// Entity, Player and Item hold a copy of the tracked entity. Exactly one of them is not nil.
+	Entity *Entity
+	Player *Player
+	Item   *ItemEntity
+}
+
+// Distance returns the distance between the entity and the position passed.
+func (e EntitySnapshot) Distance(pos mgl32.Vec3) float64 {
+	return float64(e.Position.Sub(pos).Len())
+}
+
+// eyePosition returns the position of the eyes of players and the position halfway up other entities,
+// used to check if the entity can be seen.
+func (e EntitySnapshot) eyePosition() mgl32.Vec3 {
+	if e.Player != nil {
+		return e.Position
+	}
+	height, ok := e.EntityMetadata[protocol.EntityDataKeyHeight].(float32)
+	if !ok {
+		height = 1
+	}
+	return e.Position.Add(mgl32.Vec3{0, height / 2})
+}
+
+// EntityFilter selects the entities returned by an entity query. Entities must match all fields set.
+type EntityFilter struct {
+	// Types holds the entity types to match, such as minecraft:zombie.
+	Types []string
+	// Name matches entities with the username or name tag passed.
+	Name string
+	// Center is the position distances are measured from. Radius, if not 0, only matches entities within
+	// that distance from Center.
+	Center mgl32.Vec3
+	Radius float64
+	// Box, if not nil, only matches entities within the box.
+	Box *cube.BBox
+	// Sight, if not nil, only matches entities that can be seen from Center: no solid block of the World
+	// lies in between.
+	Sight *World
+	// Match, if not nil, is called for every entity that matched the other fields.
+	Match func(EntitySnapshot) bool
+}
+
+// matches checks if the entity passed matches the filter, apart from Sight.
+func (f EntityFilter) matches(e EntitySnapshot) bool {
+	switch {
+	case len(f.Types) != 0 && !slices.Contains(f.Types, e.EntityType):
+		return false
+	case f.Name != "" && e.Name != f.Name:
+		return false
+	case f.Radius != 0 && e.Distance(f.Center) > f.Radius:
+		return false
+	case f.Box != nil && !f.Box.Vec3Within(vec32To64(e.Position)):
+		return false
+	}
+	return true
+}
+
+// visible checks if the entity passed can be seen from the Center of the filter.
+func (f EntityFilter) visible(e EntitySnapshot) bool {
+	if f.Sight == nil {
+		return true
+	}
+	dir := vec32To64(e.eyePosition().Sub(f.Center))
+	_, hit := f.Sight.Raycast(vec32To64(f.Center), dir, dir.Len())
+	return !hit
+}
+
+// chunks returns the chunk bounds of the area the filter is limited to. False is returned if the filter
+// is not limited to an area.
+func (f EntityFilter) chunks() (minPos, maxPos world.ChunkPos, ok bool) {
+	if f.Radius == 0 && f.Box == nil {
+		return minPos, maxPos, false
+	}
+	lo := mgl32.Vec3{-math.MaxFloat32, 0, -math.MaxFloat32}
+	hi := mgl32.Vec3{math.MaxFloat32, 0, math.MaxFloat32}
+	if f.Radius != 0 {
+		r := float32(f.Radius)
+		lo, hi = f.Center.Sub(mgl32.Vec3{r, 0, r}), f.Center.Add(mgl32.Vec3{r, 0, r})
+	}
+	if f.Box != nil {
+		lo = mgl32.Vec3{max(lo[0], float32(f.Box.Min()[0])), 0, max(lo[2], float32(f.Box.Min()[2]))}
+		hi = mgl32.Vec3{min(hi[0], float32(f.Box.Max()[0])), 0, min(hi[2], float32(f.Box.Max()[2]))}
+	}
+	return chunkPosFromVec3(vec32To64(lo)), chunkPosFromVec3(vec32To64(hi)), true
+}
+
+// Entities returns all entities, players and items matching the filter passed, ordered by distance to
+// the Center of the filter. Entities within a radius or box are looked up by chunk, so queries around a
+// position stay fast with many entities loaded.
+func (n *EntityManager) Entities(filter EntityFilter) []EntitySnapshot {
+	found := n.candidates(filter)
+	found = slices.DeleteFunc(found, func(e EntitySnapshot) bool {
+		return (filter.Match != nil && !filter.Match(e)) || !filter.visible(e)
+	})
+	slices.SortStableFunc(found, func(a, b EntitySnapshot) int {
+		return cmp.Compare(a.Distance(filter.Center), b.Distance(filter.Center))
+	})
+	return found
+}
+
+// Nearest returns the entity matching the filter passed that is closest to the Center of the filter.
+func (n *EntityManager) Nearest(filter EntityFilter) (EntitySnapshot, bool) {
+	found := n.candidates(filter)
+	slices.SortStableFunc(found, func(a, b EntitySnapshot) int {
+		return cmp.Compare(a.Distance(filter.Center), b.Distance(filter.Center))
+	})
+	// Raycasts are expensive, so entities are checked from the nearest one onwards.
+	for _, e := range found {
+		if (filter.Match == nil || filter.Match(e)) && filter.visible(e) {
+			return e, true
+		}
+	}
+	return EntitySnapshot{}, false
+}
+
+// ByRuntimeID returns the entity with the runtime ID passed. False is returned if it is not known.
+func (n *EntityManager) ByRuntimeID(rID uint64) (EntitySnapshot, bool) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.snapshot(rID)
+}
+
+// ByUniqueID returns the entity with the unique ID passed. False is returned if it is not known.
+func (n *EntityManager) ByUniqueID(uID int64) (EntitySnapshot, bool) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	rID, ok := n.uniqueIDs[uID]
+	if !ok {
+		return EntitySnapshot{}, false
+	}
+	return n.snapshot(rID)
+}
+
+// candidates returns snapshots of the entities matching the filter passed, without calling Match or
+// checking Sight, which is done after releasing the mutex.
+func (n *EntityManager) candidates(filter EntityFilter) []EntitySnapshot {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	var found []EntitySnapshot
+	add := func(rID uint64) {
+		if e, ok := n.snapshot(rID); ok && filter.matches(e) {
+			found = append(found, e)
+		}
+	}
+	minPos, maxPos, ok := filter.chunks()
+	if !ok || int64(maxPos[0]-minPos[0]+1)*int64(maxPos[1]-minPos[1]+1) > int64(len(n.chunks)) {
+		// Checking every chunk of the area would be slower than checking every entity.
+		for rID := range n.chunkOf {
+			add(rID)
+		}
+		return found
+	}
+	for x := minPos[0]; x <= maxPos[0]; x++ {
+		for z := minPos[1]; z <= maxPos[1]; z++ {
+			for rID := range n.chunks[world.ChunkPos{x, z}] {
+				add(rID)
+			}
+		}
+	}
+	return found
+}
+
+// snapshot returns a snapshot of the entity with the runtime ID passed. The mutex must be held.
+func (n *EntityManager) snapshot(rID uint64) (EntitySnapshot, bool) {
+	if e, ok := n.entities[rID]; ok {
+		e = e.clone()
+		return EntitySnapshot{
+			Positioner:      *e.Positioner,
+			EntityRuntimeID: rID,
+			EntityUniqueID:  e.EntityUniqueID,
+			EntityType:      e.EntityType,
+			Name:            e.EntityMetadata.NameTag(),
+			Velocity:        e.Velocity,
+			EntityMetadata:  e.EntityMetadata,
+			Attributes:      e.Attributes,
+			Equipment:       e.Equipment,
+			EntityLinks:     e.EntityLinks,
+			Entity:          e,
+		}, true
+	}
+	if p, ok := n.players[rID]; ok {
+		p = p.clone()
+		return EntitySnapshot{
+			Positioner:      *p.Positioner,
+			EntityRuntimeID: rID,
+			EntityUniqueID:  p.EntityUniqueID,
+			EntityType:      "minecraft:player",
+			Name:            p.Username,
+			Velocity:        p.Velocity,
+			EntityMetadata:  p.EntityMetadata,
+			Attributes:      p.Attributes,
+			Equipment:       p.Equipment,
+			EntityLinks:     p.EntityLinks,
+			Player:          p,
+		}, true
+	}
+	if i, ok := n.items[rID]; ok {
+		i = i.clone()
+		return EntitySnapshot{
+			Positioner:      *i.Positioner,
+			EntityRuntimeID: rID,
+			EntityUniqueID:  i.EntityUniqueID,
+			EntityType:      "minecraft:item",
+			Name:            i.EntityMetadata.NameTag(),
+			Velocity:        i.Velocity,
+			EntityMetadata:  i.EntityMetadata,
+			Item:            i,
+		}, true
+	}
+	return EntitySnapshot{}, false
+}
+
+// index moves the entity with the runtime ID passed to the chunk of the position passed in the spatial
+// index. The mutex must be held.
+func (n *EntityManager) index(rID uint64, pos mgl32.Vec3) {
+	chunkPos := chunkPosFromVec3(vec32To64(pos))
+	if old, ok := n.chunkOf[rID]; ok {
+		if old == chunkPos {
+			return
+		}
+		n.unindex(rID)
+	}
+	bucket, ok := n.chunks[chunkPos]
+	if !ok {
+		bucket = make(map[uint64]struct{})
+		n.chunks[chunkPos] = bucket
+	}
+	bucket[rID] = struct{}{}
+	n.chunkOf[rID] = chunkPos
+}
+
+// unindex removes the entity with the runtime ID passed from the spatial index. The mutex must be held.
+func (n *EntityManager) unindex(rID uint64) {
+	chunkPos, ok := n.chunkOf[rID]
+	if !ok {
+		return
+	}
+	delete(n.chunkOf, rID)
+	delete(n.chunks[chunkPos], rID)
+	if len(n.chunks[chunkPos]) == 0 {
+		delete(n.chunks, chunkPos)
+	}
+}
+
+// Entities returns the entities matching the filter passed, ordered by distance to the Center of the
+// filter. If the Center is not set, it is the eye position of the client.
+func (c *Client) Entities(filter EntityFilter) []EntitySnapshot {
+	if filter.Center == (mgl32.Vec3{}) {
+		filter.Center = c.eyePosition()
+	}
+	return c.Entity.Entities(filter)
+}
+
+// Nearest returns the entity closest to the client that matches the predicate passed. EntityManager.Nearest
+// may be used to only find entities the client can see.
+func (c *Client) Nearest(match func(EntitySnapshot) bool) (EntitySnapshot, bool) {
+	return c.Entity.Nearest(EntityFilter{Center: c.eyePosition(), Match: match})
+}
+
+// eyePosition returns the position of the eyes of the client.
+func (c *Client) eyePosition() mgl32.Vec3 {
+	if c.Self == nil {
+		return mgl32.Vec3{}
+	}
+	// Positions of players sent over the network are already at eye height.
+	return c.Self.Position
+}
@@ -0,0 +1,140 @@
+package bot
+
+import (
+	"maps"
+	"slices"
+
+	"github.com/sandertv/gophertunnel/minecraft/protocol"
+)
+
+// Metadata holds the metadata of an entity, indexed by the protocol.EntityDataKey keys. Metadata sent in a
+// SetActorData packet is merged into the metadata the entity already has.
+type Metadata map[uint32]any
+
+// Flag checks if the protocol.EntityDataFlag flag with the index passed is set. Flags with an index of 64
+// or higher are read from the second flag field.
+func (m Metadata) Flag(index uint8) bool {
+	key := uint32(protocol.EntityDataKeyFlags)
+	if index >= 64 {
+		key, index = protocol.EntityDataKeyFlagsTwo, index-64
+	}
+	v, ok := m[key].(int64)
+	return ok && v&(1<<int64(index)) != 0
+}
+
+// Sneaking checks if the entity is sneaking.
+func (m Metadata) Sneaking() bool {
+	return m.Flag(protocol.EntityDataFlagSneaking)
+}
+
+// Sprinting checks if the entity is sprinting.
+func (m Metadata) Sprinting() bool {
+	return m.Flag(protocol.EntityDataFlagSprinting)
+}
+
+// Swimming checks if the entity is swimming.
+func (m Metadata) Swimming() bool {
+	return m.Flag(protocol.EntityDataFlagSwimming)
+}
+
+// OnFire checks if the entity is burning.
+func (m Metadata) OnFire() bool {
+	return m.Flag(protocol.EntityDataFlagOnFire)
+}
+
+// Invisible checks if the entity is invisible.
+func (m Metadata) Invisible() bool {
+	return m.Flag(protocol.EntityDataFlagInvisible)
+}
+
+// Riding checks if the entity is riding another entity.
+func (m Metadata) Riding() bool {
+	return m.Flag(protocol.EntityDataFlagRiding)
+}
+
+// Baby checks if the entity is the baby variant of a mob.
+func (m Metadata) Baby() bool {
+	return m.Flag(protocol.EntityDataFlagBaby)
+}
+
+// NameTag returns the name tag shown above the entity, or an empty string if it has none.
+func (m Metadata) NameTag() string {
+	s, _ := m[protocol.EntityDataKeyName].(string)
+	return s
+}
+
+// merge returns a copy of the metadata with the values of the metadata passed set.
+func (m Metadata) merge(data map[uint32]any) Metadata {
+	merged := make(Metadata, len(m)+len(data))
+	maps.Copy(merged, m)
+	maps.Copy(merged, data)
+	return merged
+}
+
+// Attributes holds the attributes of an entity, such as its health and movement speed.
+type Attributes []protocol.AttributeValue
+
+// Value returns the value of the attribute with the name passed, for example minecraft:health. False is
+// returned if the entity does not have the attribute.
+func (a Attributes) Value(name string) (float32, bool) {
+	for _, attr := range a {
+		if attr.Name == name {
+			return attr.Value, true
+		}
+	}
+	return 0, false
+}
+
+// Health returns the health of the entity and its maximum health. Both are 0 if the health is unknown.
+func (a Attributes) Health() (health, maxHealth float32) {
+	for _, attr := range a {
+		if attr.Name == "minecraft:health" {
+			return attr.Value, attr.Max
+		}
+	}
+	return 0, 0
+}
+
+// apply returns a copy of the attributes with the attributes of an UpdateAttributes packet applied.
+func (a Attributes) apply(attributes []protocol.Attribute) Attributes {
+	applied := slices.Clone(a)
+	for _, attr := range attributes {
+		i := slices.IndexFunc(applied, func(v protocol.AttributeValue) bool {
+			return v.Name == attr.Name
+		})
+		if i == -1 {
+			applied = append(applied, attr.AttributeValue)
+			continue
+		}
+		applied[i] = attr.AttributeValue
+	}
+	return applied
+}
+
+// Equipment holds the items an entity is holding and wearing.
+type Equipment struct {
+	MainHand, OffHand protocol.ItemInstance
+	// Armour holds the helmet, chestplate, leggings and boots, in that order.
+	Armour [4]protocol.ItemInstance
+	// Body is the armour worn on the body of mobs such as horses and wolves.
+	Body protocol.ItemInstance
+}
+
+// Painting holds the data of a painting entity.
+type Painting struct {
+	// Title is the name of the motive of the painting, for example Kebab.
+	Title string
+	// Direction is the direction the painting is facing.
+	Direction int32
+}
+
+// applyLink adds or removes the link passed to or from the links of an entity, returning the updated links.
+func applyLink(links []protocol.EntityLink, link protocol.EntityLink) []protocol.EntityLink {
+	links = slices.DeleteFunc(slices.Clone(links), func(l protocol.EntityLink) bool {
+		return l.RiddenEntityUniqueID == link.RiddenEntityUniqueID && l.RiderEntityUniqueID == link.RiderEntityUniqueID
+	})
+	if link.Type != protocol.EntityLinkRemove {
+		links = append(links, link)
+	}
+	return links
+}
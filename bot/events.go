@@ -4,11 +4,12 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
-	"fmt"
+	"github.com/df-mc/atomic"
 	"github.com/df-mc/dragonfly/server/block/cube"
 	"github.com/df-mc/dragonfly/server/world"
 	_ "github.com/df-mc/dragonfly/server/world"
 	"github.com/df-mc/dragonfly/server/world/chunk"
+	"github.com/go-gl/mathgl/mgl32"
 	"github.com/goxiaoy/go-eventbus"
 	"github.com/sandertv/gophertunnel/minecraft/nbt"
 	"github.com/sandertv/gophertunnel/minecraft/protocol"
@@ -20,50 +21,69 @@ import (
 )
 
 type EventsListener struct {
-	dimensionData    []cube.Range
-	currentDimension int
+	// dimensionData holds the height range of every dimension defined by a DimensionData packet.
+	dimensionData map[int]cube.Range
+	// currentDimension is the ID of the dimension the client is in. It is only written by the read loop,
+	// but read by Client.Dimension from any goroutine.
+	currentDimension atomic.Int32
 	air              uint32
+	blobs            *blobCache
+	// chunkRadius is the chunk radius set by the server, used if the last NetworkChunkPublisherUpdate
+	// holds no radius.
+	chunkRadius int32
+	// view is the chunk view of the last NetworkChunkPublisherUpdate, or nil if none was received in the
+	// current dimension.
+	view *chunkView
+	// dimensionChange is the change of dimension in progress, published once the client spawned in the
+	// new dimension.
+	dimensionChange *DimensionChangedEvent
+	loadingScreenID protocol.Optional[uint32]
+	// evictWorld is the World of which the columns no longer needed are evicted on the next tick, if any.
+	evictWorld atomic.Value[*World]
 }
 
+// Attach spawns the client and adds the handlers of the EventsListener to it. It panics if the client
+// could not spawn.
 func (e EventsListener) Attach(c *Client) {
-	err := c.Conn.DoSpawnTimeout(time.Second * 10)
-	if err != nil {
+	if err := e.AttachContext(context.Background(), c); err != nil {
 		panic(err)
 	}
-	c.Conn.WritePacket(&packet.Respawn{
-		State: 2,
-	})
-	e.currentDimension = int(c.Conn.GameData().Dimension)
+}
 
-	e.dimensionData = append(e.dimensionData, cube.Range{-64, 319}, cube.Range{0, 127}, cube.Range{0, 255})
-	e.air, _ = chunk.StateToRuntimeID("minecraft:air", nil)
-	c.EventBus = eventbus.New()
+// AttachContext spawns the client and adds the handlers of the EventsListener to it. It returns an error
+// if the client could not spawn before ctx is done.
+func (e EventsListener) AttachContext(ctx context.Context, c *Client) error {
+	return e.attach(ctx, c)
+}
+
+// attach spawns the client and adds the handlers of the EventsListener to it.
+func (e EventsListener) attach(ctx context.Context, c *Client) error {
+	c.listener = &e
+	if c.EventBus == nil {
+		c.EventBus = eventbus.New()
+	}
 	c.Screen = NewManager(c)
-	//c.world = NewWorld(e.dimensionData[e.currentDimension])
-	c.Entity = NewEntityManager()
-	c.Self = &Player{
-		Positioner: &Positioner{
-			Position: c.Conn.GameData().PlayerPosition,
-			Pitch:    c.Conn.GameData().Pitch,
-			Yaw:      c.Conn.GameData().Yaw,
-			HeadYaw:  c.Conn.GameData().Yaw,
-		},
-		Username:        c.Conn.IdentityData().DisplayName,
-		EntityRuntimeID: c.Conn.GameData().EntityRuntimeID,
-		PlatformChatID:  c.Conn.ClientData().PlatformOnlineID,
+	if err := e.spawn(ctx, c); err != nil {
+		return err
 	}
+	c.handleDeaths()
+	c.Events.AddTicker(TickHandler{F: e.evictScheduled})
+
+	AddListener(c, PacketHandler[*packet.Disconnect]{
+		Priority: 64,
+		F: func(client *Client, p *packet.Disconnect) error {
+			// Only connections other than *minecraft.Conn, such as a replay, return Disconnect packets.
+			client.session.kicked(p.Message)
+			return nil
+		},
+	})
 
 	AddListener(c, PacketHandler[*packet.Text]{
 		Priority: 64,
 		F: func(client *Client, p *packet.Text) error {
 
 			//c.Logger.Info(text.ANSI(p.Message))
-			go func() {
-				err := eventbus.Publish[*ChatEvent](c.EventBus)(context.Background(), &ChatEvent{Message: text.Clean(p.Message), FormattedMessage: p.Message})
-				if err != nil {
-					return
-				}
-			}()
+			publishEvent(c, &ChatEvent{Message: text.Clean(p.Message), FormattedMessage: p.Message})
 			return nil
 		},
 	})
@@ -72,6 +92,7 @@ func (e EventsListener) Attach(c *Client) {
 		Priority: 64,
 		F: func(client *Client, p *packet.SetPlayerGameType) error {
 			client.Self.GameType = p.GameType
+			client.selfState.setGameType(p.GameType)
 			return nil
 		},
 	})
@@ -80,7 +101,9 @@ func (e EventsListener) Attach(c *Client) {
 		Priority: 64,
 		F: func(client *Client, p *packet.DimensionData) error {
 			for _, definition := range p.Definitions {
-				e.dimensionData = append(e.dimensionData, cube.Range{int(definition.Range[0]), int(definition.Range[1])})
+				if id, ok := dimensionID(definition.Name); ok {
+					e.dimensionData[id] = cube.Range{int(definition.Range[0]), int(definition.Range[1])}
+				}
 			}
 			return nil
 		},
@@ -88,72 +111,76 @@ func (e EventsListener) Attach(c *Client) {
 	AddListener(c, PacketHandler[*packet.ChangeDimension]{
 		Priority: 64,
 		F: func(client *Client, p *packet.ChangeDimension) error {
-			e.currentDimension = int(p.Dimension)
-			c.world = NewWorld(e.dimensionData[e.currentDimension])
-			return nil
+			e.dimensionChange = &DimensionChangedEvent{
+				From:     e.dimension(),
+				To:       int(p.Dimension),
+				Position: p.Position,
+				Respawn:  p.Respawn,
+			}
+			e.loadingScreenID = p.LoadingScreenID
+			e.currentDimension.Store(p.Dimension)
+			e.view = nil
+			e.blobs.clear()
+			left := c.world
+			left.removeView(c)
+			c.world = c.worldFor(e.dimension(), e.dimensionRange(e.dimension()))
+			if left != nil && left != c.world {
+				e.evict(c, left)
+			}
+			c.Self.Position = p.Position
+			return client.WritePacket(&packet.ServerBoundLoadingScreen{
+				Type:            packet.LoadingScreenTypeStart,
+				LoadingScreenID: p.LoadingScreenID,
+			})
 		},
 	})
-	AddListener(c, PacketHandler[*packet.LevelChunk]{
+	AddListener(c, PacketHandler[*packet.PlayStatus]{
 		Priority: 64,
-		F: func(client *Client, p *packet.LevelChunk) error {
-			ch, err := chunk.NetworkDecode(e.air, p.RawPayload, int(p.SubChunkCount), e.dimensionData[e.currentDimension])
-			if err != nil {
-				log.Warnf("Failed to decode chunk: %v", err)
+		F: func(client *Client, p *packet.PlayStatus) error {
+			if p.Status != packet.PlayStatusPlayerSpawn || e.dimensionChange == nil {
 				return nil
 			}
-
-			if c.world == nil {
-				c.world = NewWorld(e.dimensionData[e.currentDimension])
-			}
-
-			b := bytes.NewBuffer(p.RawPayload)
-
-			for i := 0; i < int(p.SubChunkCount); i++ {
-				index := uint8(i)
-				decodeSubChunk(b, chunk.New(air, e.dimensionData[e.currentDimension]), &index, chunk.NetworkEncoding)
-			}
-			n := (e.dimensionData[e.currentDimension].Height() >> 4) + 1
-			for i := 0; i < int(n); i++ {
-				decodePalettedStorage(b, chunk.NetworkEncoding, chunk.BiomePaletteEncoding)
-			}
-			column := c.world.Chunk(world.ChunkPos(p.Position))
-			if column != nil {
-				originalSub := column.Sub()
-				for i, subChunk := range ch.Sub() {
-					if subChunk.Empty() {
-						if len(originalSub) > i {
-							if !originalSub[i].Empty() {
-								ch.Sub()[i] = originalSub[i]
-							}
-						}
-					}
-				}
-			}
-
-			_, err = b.ReadByte()
-			if err != nil {
-				log.Warn(err)
-			}
-			var bNBT map[string]any
-			dec := nbt.NewDecoderWithEncoding(b, nbt.NetworkLittleEndian)
-			bEnts := map[cube.Pos]map[string]any{}
-			for {
-				err := dec.Decode(&bNBT)
-				if err != nil {
-					break
-				}
-				pos := cube.Pos{int(bNBT["x"].(int32)), int(bNBT["y"].(int32)), int(bNBT["z"].(int32))}
-				bEnts[pos] = bNBT
+			return e.completeDimensionChange(client)
+		},
+	})
+	AddListener(c, PacketHandler[*packet.ChunkRadiusUpdated]{
+		Priority: 64,
+		F: func(client *Client, p *packet.ChunkRadiusUpdated) error {
+			e.chunkRadius = p.ChunkRadius
+			e.evictChunks(client)
+			return nil
+		},
+	})
+	AddListener(c, PacketHandler[*packet.NetworkChunkPublisherUpdate]{
+		Priority: 64,
+		F: func(client *Client, p *packet.NetworkChunkPublisherUpdate) error {
+			e.view = &chunkView{
+				center: chunkPosFromBlockPos(blockPosFromProtocol(p.Position)),
+				radius: int32((p.Radius + 15) >> 4),
 			}
-
-			c.world.setChunk(world.ChunkPos(p.Position), ch, bEnts)
+			e.evictChunks(client)
 			return nil
 		},
 	})
+	AddListener(c, PacketHandler[*packet.LevelChunk]{
+		Priority: 64,
+		F: func(client *Client, p *packet.LevelChunk) error {
+			if p.CacheEnabled {
+				return e.cachedLevelChunk(client, p)
+			}
+			return e.readLevelChunk(client, p)
+		},
+	})
 	AddListener(c, PacketHandler[*packet.AddActor]{
 		Priority: 64,
 		F: func(client *Client, p *packet.AddActor) error {
 			c.Entity.AddEntity(p)
+			publishEvent(c, &EntitySpawnedEvent{
+				EntityRuntimeID: p.EntityRuntimeID,
+				EntityUniqueID:  p.EntityUniqueID,
+				EntityType:      p.EntityType,
+				Position:        p.Position,
+			})
 			return nil
 		},
 	})
@@ -161,6 +188,12 @@ func (e EventsListener) Attach(c *Client) {
 		Priority: 64,
 		F: func(client *Client, p *packet.AddPlayer) error {
 			c.Entity.AddPlayer(p)
+			publishEvent(c, &EntitySpawnedEvent{
+				EntityRuntimeID: p.EntityRuntimeID,
+				EntityUniqueID:  p.AbilityData.EntityUniqueID,
+				EntityType:      "minecraft:player",
+				Position:        p.Position,
+			})
 			return nil
 		},
 	})
@@ -168,13 +201,149 @@ func (e EventsListener) Attach(c *Client) {
 		Priority: 64,
 		F: func(client *Client, p *packet.AddItemActor) error {
 			c.Entity.AddItems(p)
+			publishEvent(c, &EntitySpawnedEvent{
+				EntityRuntimeID: p.EntityRuntimeID,
+				EntityUniqueID:  p.EntityUniqueID,
+				EntityType:      "minecraft:item",
+				Position:        p.Position,
+			})
+			return nil
+		},
+	})
+	AddListener(c, PacketHandler[*packet.AddPainting]{
+		Priority: 64,
+		F: func(client *Client, p *packet.AddPainting) error {
+			c.Entity.AddPainting(p)
+			publishEvent(c, &EntitySpawnedEvent{
+				EntityRuntimeID: p.EntityRuntimeID,
+				EntityUniqueID:  p.EntityUniqueID,
+				EntityType:      "minecraft:painting",
+				Position:        p.Position,
+			})
 			return nil
 		},
 	})
 	AddListener(c, PacketHandler[*packet.RemoveActor]{
 		Priority: 64,
 		F: func(client *Client, p *packet.RemoveActor) error {
-			c.Entity.RemoveEntity(p.EntityUniqueID)
+			if rID, entityType, ok := c.Entity.remove(p.EntityUniqueID); ok {
+				publishEvent(c, &EntityDespawnedEvent{
+					EntityRuntimeID: rID,
+					EntityUniqueID:  p.EntityUniqueID,
+					EntityType:      entityType,
+				})
+			}
+			return nil
+		},
+	})
+	AddListener(c, PacketHandler[*packet.SetActorData]{
+		Priority: 64,
+		F: func(client *Client, p *packet.SetActorData) error {
+			if old, data, ok := c.Entity.setMetadata(p); ok {
+				publishEvent(c, &EntityMetadataChangedEvent{EntityRuntimeID: p.EntityRuntimeID, Old: old, New: data})
+			}
+			return nil
+		},
+	})
+	AddListener(c, PacketHandler[*packet.UpdateAttributes]{
+		Priority: 64,
+		F: func(client *Client, p *packet.UpdateAttributes) error {
+			if p.EntityRuntimeID == client.Self.EntityRuntimeID {
+				client.setSelfAttributes(p.Attributes)
+				return nil
+			}
+			c.Entity.SetAttributes(p)
+			return nil
+		},
+	})
+	AddListener(c, PacketHandler[*packet.SetHealth]{
+		Priority: 64,
+		F: func(client *Client, p *packet.SetHealth) error {
+			client.setSelfHealth(float32(p.Health))
+			return nil
+		},
+	})
+	AddListener(c, PacketHandler[*packet.MobEffect]{
+		Priority: 64,
+		F: func(client *Client, p *packet.MobEffect) error {
+			if p.EntityRuntimeID == client.Self.EntityRuntimeID {
+				client.selfState.applyEffect(p)
+			}
+			return nil
+		},
+	})
+	AddListener(c, PacketHandler[*packet.UpdateAbilities]{
+		Priority: 64,
+		F: func(client *Client, p *packet.UpdateAbilities) error {
+			if p.AbilityData.EntityUniqueID == client.conn.GameData().EntityUniqueID {
+				client.selfState.applyAbilities(p.AbilityData)
+			}
+			return nil
+		},
+	})
+	AddListener(c, PacketHandler[*packet.SetSpawnPosition]{
+		Priority: 64,
+		F: func(client *Client, p *packet.SetSpawnPosition) error {
+			client.selfState.setSpawn(p)
+			return nil
+		},
+	})
+	AddListener(c, PacketHandler[*packet.ActorEvent]{
+		Priority: 64,
+		F: func(client *Client, p *packet.ActorEvent) error {
+			if p.EntityRuntimeID == client.Self.EntityRuntimeID && p.EventType == packet.ActorEventDeath {
+				client.selfDied()
+			}
+			return nil
+		},
+	})
+	AddListener(c, PacketHandler[*packet.DeathInfo]{
+		Priority: 64,
+		F: func(client *Client, p *packet.DeathInfo) error {
+			client.selfState.setDeathCause(p.Cause)
+			return nil
+		},
+	})
+	AddListener(c, PacketHandler[*packet.Respawn]{
+		Priority: 64,
+		F: func(client *Client, p *packet.Respawn) error {
+			if p.State != packet.RespawnStateReadyToSpawn {
+				return nil
+			}
+			// The position is read by the tick loop, so it is changed there.
+			client.Schedule(0, func(c *Client) {
+				c.Self.Position = p.Position
+			})
+			e.blobs.clear()
+			client.readyToSpawn(p.Position)
+			return nil
+		},
+	})
+	AddListener(c, PacketHandler[*packet.SetActorMotion]{
+		Priority: 64,
+		F: func(client *Client, p *packet.SetActorMotion) error {
+			c.Entity.SetMotion(p)
+			return nil
+		},
+	})
+	AddListener(c, PacketHandler[*packet.SetActorLink]{
+		Priority: 64,
+		F: func(client *Client, p *packet.SetActorLink) error {
+			c.Entity.SetLink(p)
+			return nil
+		},
+	})
+	AddListener(c, PacketHandler[*packet.MobEquipment]{
+		Priority: 64,
+		F: func(client *Client, p *packet.MobEquipment) error {
+			c.Entity.SetEquipment(p)
+			return nil
+		},
+	})
+	AddListener(c, PacketHandler[*packet.MobArmourEquipment]{
+		Priority: 64,
+		F: func(client *Client, p *packet.MobArmourEquipment) error {
+			c.Entity.SetArmour(p)
 			return nil
 		},
 	})
@@ -199,14 +368,14 @@ func (e EventsListener) Attach(c *Client) {
 			json.Unmarshal(p.FormData, &data)
 			data.ID = p.FormID
 			c.CurrentForm = &data
-			go eventbus.Publish[*Form](c.EventBus)(context.Background(), c.CurrentForm)
+			publishEvent(c, c.CurrentForm)
 			return nil
 		},
 	})
 	AddListener(c, PacketHandler[*packet.MovePlayer]{
 		Priority: 64,
 		F: func(client *Client, p *packet.MovePlayer) error {
-			if p.EntityRuntimeID == c.Conn.GameData().EntityRuntimeID {
+			if p.EntityRuntimeID == c.conn.GameData().EntityRuntimeID {
 				//log.Info("Moved", p.Position)
 
 				c.Self.Position = p.Position
@@ -230,46 +399,79 @@ func (e EventsListener) Attach(c *Client) {
 	})
 	AddListener(c, PacketHandler[*packet.UpdateBlock]{
 		F: func(client *Client, p *packet.UpdateBlock) error {
-			if p.Layer != 0 {
-				return nil
-			}
-			if p.Position.X() == -9729 && p.Position.Z() == 1102 && p.Position.Y() == 104 {
-				fmt.Println(p.Layer, p.NewBlockRuntimeID, "456456456456")
-
+			pos := blockPosFromProtocol(p.Position)
+			client.changeBlock(pos, uint8(p.Layer), p.NewBlockRuntimeID, p.Flags, BlockChangeUpdate)
+			if p.Layer == 0 && p.NewBlockRuntimeID == air {
+				publishEvent(c, &BrokeBlockEvent{
+					Position: p.Position,
+				})
 			}
-			//if p.Flags&packet.BlockUpdateNetwork != p.Flags {
-			//	return nil
-			//}
-			client.world.setBlock(blockPosFromProtocol(p.Position), p.NewBlockRuntimeID)
-			if p.NewBlockRuntimeID == air {
-				go func() {
-					err := eventbus.Publish[*BrokeBlockEvent](c.EventBus)(context.Background(), &BrokeBlockEvent{
-						Position: p.Position,
-					})
-					if err != nil {
-						return
-					}
-				}()
-			}
-
 			return nil
 		},
 	})
 	AddListener(c, PacketHandler[*packet.UpdateSubChunkBlocks]{
 		F: func(client *Client, p *packet.UpdateSubChunkBlocks) error {
+			e.updateSubChunkBlocks(client, p)
 			return nil
 		},
 	})
+	AddListener(c, PacketHandler[*packet.ClientCacheMissResponse]{
+		Priority: 64,
+		F: func(client *Client, p *packet.ClientCacheMissResponse) error {
+			return e.blobs.receive(p.Blobs)
+		},
+	})
+	AddListener(c, PacketHandler[*packet.SubChunk]{
+		Priority: 64,
+		F: func(client *Client, p *packet.SubChunk) error {
+			return e.readSubChunks(client, p)
+		},
+	})
 	AddListener(c, PacketHandler[*packet.PlayerList]{
 		F: func(client *Client, p *packet.PlayerList) error {
 			if p.ActionType == packet.PlayerListActionAdd {
 				for _, entry := range p.Entries {
-					if c.Conn.IdentityData().XUID == entry.XUID {
+					if c.conn.IdentityData().XUID == entry.XUID {
 						c.PlayerName = entry.Username
 					}
 				}
 			}
-
+			added, removed := c.Roster.apply(p)
+			for _, entry := range added {
+				publishEvent(c, &PlayerJoinedEvent{Entry: entry})
+			}
+			for _, entry := range removed {
+				publishEvent(c, &PlayerLeftEvent{Entry: entry})
+			}
+			return nil
+		},
+	})
+	AddListener(c, PacketHandler[*packet.SetTime]{
+		Priority: 64,
+		F: func(client *Client, p *packet.SetTime) error {
+			client.levelTime.setTime(int64(p.Time))
+			return nil
+		},
+	})
+	AddListener(c, PacketHandler[*packet.LevelEvent]{
+		Priority: 64,
+		F: func(client *Client, p *packet.LevelEvent) error {
+			client.levelTime.applyLevelEvent(p)
+			return nil
+		},
+	})
+	AddListener(c, PacketHandler[*packet.GameRulesChanged]{
+		Priority: 64,
+		F: func(client *Client, p *packet.GameRulesChanged) error {
+			client.levelTime.setGameRules(p.GameRules)
+			return nil
+		},
+	})
+	AddListener(c, PacketHandler[*packet.ClientBoundMapItemData]{
+		Priority: 64,
+		F: func(client *Client, p *packet.ClientBoundMapItemData) error {
+			client.mapItems.apply(p)
+			publishEvent(c, &MapUpdatedEvent{ID: p.MapID, Flags: p.UpdateFlags})
 			return nil
 		},
 	})
@@ -279,29 +481,145 @@ func (e EventsListener) Attach(c *Client) {
 			return nil
 		},
 	})
+	return nil
+}
+
+// spawn completes the spawn sequence of the current connection and resets all state tied to the
+// previous session. It is called by Attach and again after every reconnect, so the listeners registered
+// by Attach are kept.
+func (e *EventsListener) spawn(ctx context.Context, c *Client) error {
+	ctx, cancel := context.WithTimeout(ctx, time.Second*10)
+	defer cancel()
+	if err := c.conn.DoSpawnContext(ctx); err != nil {
+		return err
+	}
+	c.WritePacket(&packet.Respawn{
+		State: 2,
+	})
+	e.currentDimension.Store(c.conn.GameData().Dimension)
+
+	e.dimensionData = map[int]cube.Range{}
+	e.dimensionChange = nil
+	var w weather
+	if startWeather := c.session.startWeather.Load(); startWeather != nil {
+		w = *startWeather
+	}
+	c.levelTime.reset(c.conn.GameData().Time, c.conn.GameData().GameRules, w)
+	c.selfState.reset(c.conn.GameData())
+	e.air, _ = chunk.StateToRuntimeID("minecraft:air", nil)
+	e.blobs = newBlobCache(c.config.BlobCache)
+	e.chunkRadius = c.conn.GameData().ChunkRadius
+	e.view = nil
+	c.resetWorlds()
+	c.Entity = NewEntityManager()
+	c.Roster = NewRoster()
+	c.Screen.reset()
+	c.CurrentForm = nil
+	c.Self = &Player{
+		Positioner: &Positioner{
+			Position: c.conn.GameData().PlayerPosition,
+			Pitch:    c.conn.GameData().Pitch,
+			Yaw:      c.conn.GameData().Yaw,
+			HeadYaw:  c.conn.GameData().Yaw,
+		},
+		Username:        c.conn.IdentityData().DisplayName,
+		EntityRuntimeID: c.conn.GameData().EntityRuntimeID,
+		PlatformChatID:  c.conn.ClientData().PlatformOnlineID,
+	}
+	return nil
+}
+
+// readLevelChunk decodes the chunk of a LevelChunk packet into the World, or requests its sub chunks if
+// it was sent in sub chunk request mode.
+func (e *EventsListener) readLevelChunk(c *Client, p *packet.LevelChunk) error {
+	if subChunkRequestMode(p) {
+		return e.requestSubChunks(c, p)
+	}
+	ch, err := chunk.NetworkDecode(e.air, p.RawPayload, int(p.SubChunkCount), e.dimensionRange(e.dimension()))
+	if err != nil {
+		log.Warnf("Failed to decode chunk: %v", err)
+		return nil
+	}
+
+	if c.world == nil {
+		c.world = c.worldFor(e.dimension(), e.dimensionRange(e.dimension()))
+	}
+
+	b := bytes.NewBuffer(p.RawPayload)
+
+	for i := 0; i < int(p.SubChunkCount); i++ {
+		index := uint8(i)
+		decodeSubChunk(b, chunk.New(air, e.dimensionRange(e.dimension())), &index, chunk.NetworkEncoding)
+	}
+	n := (e.dimensionRange(e.dimension()).Height() >> 4) + 1
+	for i := 0; i < int(n); i++ {
+		decodePalettedStorage(b, chunk.NetworkEncoding, chunk.BiomePaletteEncoding)
+	}
+	pos := world.ChunkPos(p.Position)
+	column := c.world.loadedChunk(pos)
+	if column != nil {
+		column.Lock()
+		originalSub := column.Sub()
+		for i, subChunk := range ch.Sub() {
+			if i >= len(originalSub) {
+				break
+			}
+			if i >= int(p.SubChunkCount) {
+				// Sub chunks above those sent are kept, as servers may only send the lower sub chunks.
+				if !originalSub[i].Empty() {
+					ch.Sub()[i] = originalSub[i]
+				}
+			} else if !column.subPending(i) {
+				// Sub chunks sent are compared even if empty, as they are air.
+				c.diffSubChunks(pos, i+(e.dimensionRange(e.dimension()).Min()>>4), originalSub[i], subChunk)
+			}
+		}
+		column.Unlock()
+	}
+
+	_, err = b.ReadByte()
+	if err != nil {
+		log.Warn(err)
+	}
+	var bNBT map[string]any
+	dec := nbt.NewDecoderWithEncoding(b, nbt.NetworkLittleEndian)
+	bEnts := map[cube.Pos]map[string]any{}
+	for {
+		err := dec.Decode(&bNBT)
+		if err != nil {
+			break
+		}
+		bPos := cube.Pos{int(bNBT["x"].(int32)), int(bNBT["y"].(int32)), int(bNBT["z"].(int32))}
+		bEnts[bPos] = bNBT
+	}
+
+	c.world.setChunk(pos, ch, bEnts)
+	publishEvent(c, &ChunkLoadedEvent{Position: pos, Dimension: e.dimension()})
+	e.evictChunks(c)
+	return nil
 }
 
 func (e *EventsListener) ReadChunk(c *Client, p *packet.LevelChunk) error {
-	ch, err := chunk.NetworkDecode(e.air, p.RawPayload, int(p.SubChunkCount), e.dimensionData[e.currentDimension])
+	ch, err := chunk.NetworkDecode(e.air, p.RawPayload, int(p.SubChunkCount), e.dimensionRange(e.dimension()))
 	if err != nil {
 		return nil
 	}
 
 	if c.world == nil {
-		c.world = NewWorld(e.dimensionData[e.currentDimension])
+		c.world = c.worldFor(e.dimension(), e.dimensionRange(e.dimension()))
 	}
 
 	b := bytes.NewBuffer(p.RawPayload)
 
 	for i := 0; i < int(p.SubChunkCount); i++ {
 		index := uint8(i)
-		decodeSubChunk(b, chunk.New(air, e.dimensionData[e.currentDimension]), &index, chunk.NetworkEncoding)
+		decodeSubChunk(b, chunk.New(air, e.dimensionRange(e.dimension())), &index, chunk.NetworkEncoding)
 	}
-	n := (e.dimensionData[e.currentDimension].Height() >> 4) + 1
+	n := (e.dimensionRange(e.dimension()).Height() >> 4) + 1
 	for i := 0; i < int(n); i++ {
 		decodePalettedStorage(b, chunk.NetworkEncoding, chunk.BiomePaletteEncoding)
 	}
-	column := c.world.Chunk(world.ChunkPos(p.Position))
+	column := c.world.loadedChunk(world.ChunkPos(p.Position))
 	if column != nil {
 		originalSub := column.Sub()
 		for i, subChunk := range ch.Sub() {
@@ -340,21 +658,149 @@ func (c *Client) World() *World {
 	return c.world
 }
 
+// newWorld returns a World for the dimension passed. Clients of a Fleet share their worlds.
+func (c *Client) newWorld(dimension int, r cube.Range) *World {
+	if c.sharedWorld != nil {
+		return c.sharedWorld(dimension, r)
+	}
+	w := NewWorld(r)
+	w.dimension = dimension
+	w.SetMemoryLimit(c.config.WorldMemoryLimit)
+	if c.mirror != nil && c.session != nil {
+		c.mirror.mirror(c, w)
+	}
+	return w
+}
+
 //go:linkname decodePalettedStorage github.com/df-mc/dragonfly/server/world/chunk.decodePalettedStorage
 func decodePalettedStorage(buf *bytes.Buffer, e chunk.Encoding, pe any) (*chunk.PalettedStorage, error)
 
 //go:linkname decodeBiomes github.com/df-mc/dragonfly/server/world/chunk.decodeBiomes
-func decodeBiomes(buf *bytes.Buffer, c *chunk.Chunk, e chunk.Encoding)
+func decodeBiomes(buf *bytes.Buffer, c *chunk.Chunk, e chunk.Encoding) error
 
 //go:linkname decodeSubChunk github.com/df-mc/dragonfly/server/world/chunk.decodeSubChunk
 func decodeSubChunk(buf *bytes.Buffer, c *chunk.Chunk, index *byte, e chunk.Encoding) (*chunk.SubChunk, error)
 
 // Events Sections
 
+// DimensionChangedEvent is published once the client spawned in a new dimension.
+type DimensionChangedEvent struct {
+	From, To int
+	// Position is the position the client spawned at in the new dimension.
+	Position mgl32.Vec3
+	// Respawn is true if the client changed dimension because it respawned.
+	Respawn bool
+}
+
+// MapUpdatedEvent is published when the server updated a map. Flags holds the packet.MapUpdateFlag
+// flags of the parts updated.
+type MapUpdatedEvent struct {
+	ID    int64
+	Flags uint32
+}
+
 type BrokeBlockEvent struct {
 	Position protocol.BlockPos
 }
 
+// BlockChangeEvent is published for every block of the World that changed. Handlers may be added with
+// OnBlockChange to only receive changes within a region or of certain blocks.
+type BlockChangeEvent struct {
+	Position cube.Pos
+	Old, New world.Block
+	// Layer is the layer of the block, 1 being the liquid of waterlogged blocks.
+	Layer uint8
+	// Flags holds the packet.BlockUpdate flags sent with the change, if any.
+	Flags  uint32
+	Source BlockChangeSource
+}
+
+// ChunkLoadedEvent is published when a chunk was received, before its sub chunks if they are requested
+// separately.
+type ChunkLoadedEvent struct {
+	Position  world.ChunkPos
+	Dimension int
+}
+
+// ChunkUnloadedEvent is published when a chunk is no longer loaded by the client.
+type ChunkUnloadedEvent struct {
+	Position  world.ChunkPos
+	Dimension int
+}
+
+// EntitySpawnedEvent is published when an entity, player, item or painting was added to the
+// EntityManager.
+type EntitySpawnedEvent struct {
+	EntityRuntimeID uint64
+	EntityUniqueID  int64
+	// EntityType is the type of the entity, minecraft:player for players and minecraft:item for items.
+	EntityType string
+	Position   mgl32.Vec3
+}
+
+// EntityDespawnedEvent is published when an entity was removed from the EntityManager.
+type EntityDespawnedEvent struct {
+	EntityRuntimeID uint64
+	EntityUniqueID  int64
+	EntityType      string
+}
+
+// EntityMetadataChangedEvent is published when the metadata of an entity changed, for example when it
+// started sneaking or was set on fire.
+type EntityMetadataChangedEvent struct {
+	EntityRuntimeID uint64
+	Old, New        Metadata
+}
+
+// PlayerJoinedEvent is published when a player was added to the Roster. When the client spawns, it is
+// published for every player already online.
+type PlayerJoinedEvent struct {
+	Entry RosterEntry
+}
+
+// PlayerLeftEvent is published when a player was removed from the Roster.
+type PlayerLeftEvent struct {
+	Entry RosterEntry
+}
+
+// DamagedEvent is published when the health of the client dropped.
+type DamagedEvent struct {
+	Health, Previous float32
+}
+
+// DiedEvent is published when the client died. The cause of death is set in the SelfState once the server
+// sent it.
+type DiedEvent struct {
+	Position mgl32.Vec3
+}
+
+// RespawnedEvent is published when the client respawned after dying.
+type RespawnedEvent struct {
+	Position mgl32.Vec3
+}
+
+// DisconnectedEvent is published by Run every time a session ends.
+type DisconnectedEvent struct {
+	Err *SessionError
+}
+
+// ReconnectingEvent is published by Run before every reconnect attempt.
+type ReconnectingEvent struct {
+	Attempt int
+	Delay   time.Duration
+}
+
+// ReconnectedEvent is published by Run once the client spawned again after a reconnect.
+type ReconnectedEvent struct {
+	Attempt int
+}
+
+// HandlerErrorEvent is published when a packet handler returns an error other than Cancel.
+type HandlerErrorEvent struct {
+	Packet packet.Packet
+	Err    error
+}
+
 type ChatEvent struct {
 	Message          string
 	FormattedMessage string
@@ -0,0 +1,251 @@
+package bot
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/df-mc/dragonfly/server/block/cube"
+	"github.com/go-gl/mathgl/mgl32"
+	"github.com/google/uuid"
+	"github.com/sandertv/gophertunnel/minecraft/protocol/packet"
+)
+
+// FleetConfig is the config of a Fleet.
+type FleetConfig struct {
+	// Clients holds the config of every client of the fleet, usually one per account.
+	Clients []ClientConfig
+	// Stagger is the delay between the logins of two clients, as servers often limit the logins per
+	// address.
+	Stagger time.Duration
+	// BlobCache, if set, is used as ClientConfig.BlobCache by clients without one, so that chunk blobs are
+	// shared by the whole fleet.
+	BlobCache BlobStore
+	// Setup, if set, is called with every client before it connects, for example to add listeners.
+	Setup func(c *Client)
+}
+
+// Sighting is the last known location of a player seen by any client of a Fleet.
+type Sighting struct {
+	Username  string
+	UUID      uuid.UUID
+	Position  mgl32.Vec3
+	Dimension int
+	// SeenBy is the name of the client that saw the player.
+	SeenBy string
+	Time   time.Time
+}
+
+// fleetWorld identifies a World shared by the clients of a Fleet.
+type fleetWorld struct {
+	address   string
+	dimension int
+}
+
+// Fleet runs a group of clients that share what they learn. Clients on the same server share one World
+// per dimension, so chunks and block entities seen by one client are known to all, and every player seen
+// by any client is kept as a Sighting.
+type Fleet struct {
+	config FleetConfig
+
+	mu        sync.Mutex
+	clients   []*Client
+	worlds    map[fleetWorld]*World
+	sightings map[uuid.UUID]Sighting
+}
+
+// NewFleet returns a Fleet for the config passed. Its clients are started with Run.
+func NewFleet(config FleetConfig) *Fleet {
+	return &Fleet{
+		config:    config,
+		worlds:    map[fleetWorld]*World{},
+		sightings: map[uuid.UUID]Sighting{},
+	}
+}
+
+// Run logs in all clients, one every FleetConfig.Stagger, and runs them with Client.Run until ctx is
+// cancelled or all of them stopped. The errors of all clients are joined.
+func (f *Fleet) Run(ctx context.Context) error {
+	var (
+		wg   sync.WaitGroup
+		mu   sync.Mutex
+		errs []error
+	)
+	for i, config := range f.config.Clients {
+		if i > 0 && f.config.Stagger > 0 {
+			t := time.NewTimer(f.config.Stagger)
+			select {
+			case <-ctx.Done():
+				t.Stop()
+			case <-t.C:
+			}
+		}
+		if ctx.Err() != nil {
+			break
+		}
+
+		if config.BlobCache == nil {
+			config.BlobCache = f.config.BlobCache
+		}
+		c := f.newClient()
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := f.runClient(ctx, c, config); err != nil && !errors.Is(err, context.Canceled) {
+				c.Logger.Warnf("fleet client %v stopped: %v", config.Address, err)
+				mu.Lock()
+				errs = append(errs, err)
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	return errors.Join(errs...)
+}
+
+// newClient returns a new client sharing the state of the fleet and adds it to the fleet.
+func (f *Fleet) newClient() *Client {
+	c := NewClient()
+	c.sharedWorld = func(dimension int, r cube.Range) *World {
+		return f.world(c.config.Address, dimension, r, c.config.WorldMemoryLimit)
+	}
+	AddListener(c, PacketHandler[*packet.AddPlayer]{
+		F: func(client *Client, p *packet.AddPlayer) error {
+			f.sight(client, p.UUID, p.Username, p.Position)
+			return nil
+		},
+	})
+	AddListener(c, PacketHandler[*packet.MovePlayer]{
+		F: func(client *Client, p *packet.MovePlayer) error {
+			if pl := client.Entity.GetPlayer(p.EntityRuntimeID); pl != nil {
+				f.sight(client, pl.UUID, pl.Username, p.Position)
+			}
+			return nil
+		},
+	})
+	if f.config.Setup != nil {
+		f.config.Setup(c)
+	}
+
+	f.mu.Lock()
+	f.clients = append(f.clients, c)
+	f.mu.Unlock()
+	return c
+}
+
+// runClient connects the client passed and runs it.
+func (f *Fleet) runClient(ctx context.Context, c *Client, config ClientConfig) error {
+	if err := c.ConnectToContext(ctx, config); err != nil {
+		return fmt.Errorf("connect: %w", err)
+	}
+	if err := (EventsListener{}).attach(ctx, c); err != nil {
+		_ = c.conn.Close()
+		return fmt.Errorf("spawn: %w", err)
+	}
+	return c.Run(ctx)
+}
+
+// world returns the World shared by all clients on the address passed for the dimension passed. A new
+// World gets the memory limit passed, which is the ClientConfig.WorldMemoryLimit of the client creating
+// it.
+func (f *Fleet) world(address string, dimension int, r cube.Range, limit int64) *World {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	key := fleetWorld{address: address, dimension: dimension}
+	w, ok := f.worlds[key]
+	if !ok || w.Range() != r {
+		w = NewWorld(r)
+		w.dimension = dimension
+		w.SetMemoryLimit(limit)
+		f.worlds[key] = w
+	}
+	return w
+}
+
+// sight records that the client passed saw a player at the position passed.
+func (f *Fleet) sight(c *Client, id uuid.UUID, username string, pos mgl32.Vec3) {
+	dimension := c.Dimension()
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.sightings[id] = Sighting{
+		Username:  username,
+		UUID:      id,
+		Position:  pos,
+		Dimension: dimension,
+		SeenBy:    c.conn.IdentityData().DisplayName,
+		Time:      time.Now(),
+	}
+}
+
+// Clients returns all clients of the fleet started so far.
+func (f *Fleet) Clients() []*Client {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]*Client(nil), f.clients...)
+}
+
+// World returns the World shared by the clients on the address passed for the dimension passed, or nil
+// if no client received chunks of it yet.
+func (f *Fleet) World(address string, dimension int) *World {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.worlds[fleetWorld{address: address, dimension: dimension}]
+}
+
+// Sightings returns the last sighting of every player seen by any client of the fleet.
+func (f *Fleet) Sightings() []Sighting {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	sightings := make([]Sighting, 0, len(f.sightings))
+	for _, s := range f.sightings {
+		sightings = append(sightings, s)
+	}
+	return sightings
+}
+
+// LastSeen returns the last sighting of the player with the username passed.
+func (f *Fleet) LastSeen(username string) (Sighting, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, s := range f.sightings {
+		if s.Username == username {
+			return s, true
+		}
+	}
+	return Sighting{}, false
+}
+
+// Each calls fn with every connected client of the fleet and joins the errors returned.
+func (f *Fleet) Each(fn func(c *Client) error) error {
+	var errs []error
+	for _, c := range f.Clients() {
+		if !c.connected.Load() {
+			continue
+		}
+		if err := fn(c); err != nil {
+			errs = append(errs, fmt.Errorf("%v: %w", c.conn.IdentityData().DisplayName, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Command runs the command passed on every connected client of the fleet.
+func (f *Fleet) Command(command string) error {
+	return f.Each(func(c *Client) error {
+		return c.SendCommand(command)
+	})
+}
+
+// Broadcast publishes the event passed on the EventBus of every client of the fleet, so that clients can
+// coordinate through their usual event subscriptions.
+func Broadcast[E any](ctx context.Context, f *Fleet, event E) error {
+	var errs []error
+	for _, c := range f.Clients() {
+		if err := publishNow(ctx, c, event); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
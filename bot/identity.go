@@ -0,0 +1,188 @@
+package bot
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+
+	"github.com/sandertv/go-raknet"
+	"github.com/sandertv/gophertunnel/minecraft"
+	"github.com/sandertv/gophertunnel/minecraft/protocol"
+	"github.com/sandertv/gophertunnel/minecraft/protocol/login"
+	"github.com/sandertv/gophertunnel/minecraft/protocol/packet"
+)
+
+// ErrUnsupportedClientData is returned by ConnectTo if ClientConfig.ClientData cannot be sent as set.
+var ErrUnsupportedClientData = errors.New("unsupported client data")
+
+// UI profiles as found in login.ClientData.
+const (
+	UIProfileClassic = 0
+	UIProfilePocket  = 1
+)
+
+// defaultClientData returns the client data used when ClientConfig.ClientData is nil: the Android preset
+// with the zh_TW language.
+func defaultClientData() login.ClientData {
+	data := ClientDataPreset(protocol.DeviceAndroid)
+	data.LanguageCode = "zh_TW"
+	return data
+}
+
+// ClientDataPreset returns client data that mimics a real client running on the device passed. Fields
+// that are not device specific, such as the skin and language, are left empty, so that they can be filled
+// in by the caller or get the defaults of gophertunnel. Devices without a preset get the Android one.
+// Presets of devices other than Android can only be used when logging in offline: with a
+// ClientConfig.Token, gophertunnel always reports an Android device, so ConnectTo returns an error for them.
+func ClientDataPreset(device protocol.DeviceOS) login.ClientData {
+	switch device {
+	case protocol.DeviceIOS:
+		return login.ClientData{
+			DeviceModel:      "iPhone15,3",
+			DeviceOS:         protocol.DeviceIOS,
+			DefaultInputMode: packet.InputModeTouch,
+			CurrentInputMode: packet.InputModeTouch,
+			UIProfile:        UIProfilePocket,
+			GUIScale:         -1,
+			MemoryTier:       4,
+			MaxViewDistance:  24,
+			PlatformType:     1,
+		}
+	case protocol.DeviceWin10, protocol.DeviceWin32:
+		return login.ClientData{
+			DeviceModel:                      "",
+			DeviceOS:                         protocol.DeviceWin10,
+			DefaultInputMode:                 packet.InputModeMouse,
+			CurrentInputMode:                 packet.InputModeMouse,
+			UIProfile:                        UIProfileClassic,
+			MemoryTier:                       5,
+			MaxViewDistance:                  96,
+			CompatibleWithClientSideChunkGen: true,
+		}
+	case protocol.DeviceXBOX:
+		return login.ClientData{
+			DeviceModel:      "Xbox Series X",
+			DeviceOS:         protocol.DeviceXBOX,
+			DefaultInputMode: packet.InputModeGamePad,
+			CurrentInputMode: packet.InputModeGamePad,
+			UIProfile:        UIProfileClassic,
+			MemoryTier:       5,
+			MaxViewDistance:  48,
+			PlatformType:     2,
+		}
+	case protocol.DeviceOrbis:
+		return login.ClientData{
+			DeviceModel:      "PlayStation 5",
+			DeviceOS:         protocol.DeviceOrbis,
+			DefaultInputMode: packet.InputModeGamePad,
+			CurrentInputMode: packet.InputModeGamePad,
+			UIProfile:        UIProfileClassic,
+			MemoryTier:       5,
+			MaxViewDistance:  48,
+			PlatformType:     2,
+		}
+	case protocol.DeviceNX:
+		return login.ClientData{
+			DeviceModel:      "Switch",
+			DeviceOS:         protocol.DeviceNX,
+			DefaultInputMode: packet.InputModeGamePad,
+			CurrentInputMode: packet.InputModeGamePad,
+			UIProfile:        UIProfileClassic,
+			MemoryTier:       2,
+			MaxViewDistance:  12,
+			PlatformType:     2,
+		}
+	default:
+		return login.ClientData{
+			DeviceModel:      "SAMSUNG SM-S918B",
+			DeviceOS:         protocol.DeviceAndroid,
+			DefaultInputMode: packet.InputModeTouch,
+			CurrentInputMode: packet.InputModeTouch,
+			UIProfile:        UIProfilePocket,
+			GUIScale:         -1,
+			MemoryTier:       4,
+			MaxViewDistance:  22,
+			PlatformType:     1,
+		}
+	}
+}
+
+// clientData returns the client data to log in with for the config passed.
+func (config ClientConfig) clientData() login.ClientData {
+	if config.ClientData == nil {
+		return defaultClientData()
+	}
+	return *config.ClientData
+}
+
+// validateClientData returns an error if the client data of the config cannot be sent as set. When logging
+// in with a Token, gophertunnel always reports DeviceOS as Android and GameVersion as the current version.
+func (config ClientConfig) validateClientData() error {
+	data := config.ClientData
+	if data == nil || config.Token == nil {
+		return nil
+	}
+	if data.DeviceOS != 0 && data.DeviceOS != protocol.DeviceAndroid {
+		return fmt.Errorf("%w: device %v cannot log in with a token, only Android can", ErrUnsupportedClientData, data.DeviceOS)
+	}
+	if data.GameVersion != "" && data.GameVersion != protocol.CurrentVersion {
+		return fmt.Errorf("%w: game version %v cannot log in with a token, only %v can", ErrUnsupportedClientData, data.GameVersion, protocol.CurrentVersion)
+	}
+	return nil
+}
+
+// dialAddress returns the network and address to dial the server of the config with, and the context to
+// dial with. gophertunnel sends the address dialed as the server address of the client data, so if
+// ClientData overrides it, that address is dialed on the serverAddressNetwork, which dials Address instead.
+func (config ClientConfig) dialAddress(ctx context.Context) (context.Context, string, string) {
+	if config.ClientData == nil || config.ClientData.ServerAddress == "" || config.ClientData.ServerAddress == config.Address {
+		return ctx, "raknet", config.Address
+	}
+	return context.WithValue(ctx, dialAddressKey{}, config.Address), serverAddressNetwork, config.ClientData.ServerAddress
+}
+
+// serverAddressNetwork is the ID of the network dialed when the server address of the client data is
+// overridden.
+const serverAddressNetwork = "bot-server-address"
+
+func init() {
+	minecraft.RegisterNetwork(serverAddressNetwork, func(l *slog.Logger) minecraft.Network {
+		return addressNetwork{l: l}
+	})
+}
+
+// dialAddressKey is the context key of the address dialed by addressNetwork.
+type dialAddressKey struct{}
+
+// addressNetwork is a RakNet network that pings and dials the address held by the context passed,
+// whatever address it is asked to dial.
+type addressNetwork struct {
+	l *slog.Logger
+}
+
+// DialContext ...
+func (n addressNetwork) DialContext(ctx context.Context, _ string) (net.Conn, error) {
+	address, _ := ctx.Value(dialAddressKey{}).(string)
+	return raknet.Dialer{ErrorLog: n.l.With("net origin", "raknet")}.DialContext(ctx, address)
+}
+
+// PingContext ...
+func (n addressNetwork) PingContext(ctx context.Context, _ string) ([]byte, error) {
+	address, _ := ctx.Value(dialAddressKey{}).(string)
+	return raknet.Dialer{ErrorLog: n.l.With("net origin", "raknet")}.PingContext(ctx, address)
+}
+
+// Listen ...
+func (n addressNetwork) Listen(string) (minecraft.NetworkListener, error) {
+	return nil, errors.New("listening is not supported")
+}
+
+// identityData returns the identity data to log in with for the config passed.
+func (config ClientConfig) identityData() login.IdentityData {
+	if config.IdentityData == nil {
+		return login.IdentityData{}
+	}
+	return *config.IdentityData
+}
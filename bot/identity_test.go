@@ -0,0 +1,63 @@
+package bot
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/sandertv/gophertunnel/minecraft/protocol"
+	"github.com/sandertv/gophertunnel/minecraft/protocol/login"
+	"golang.org/x/oauth2"
+)
+
+func TestValidateClientData(t *testing.T) {
+	token := &oauth2.Token{}
+	ios := ClientDataPreset(protocol.DeviceIOS)
+	android := ClientDataPreset(protocol.DeviceAndroid)
+	oldVersion := login.ClientData{GameVersion: "1.20.51"}
+	tests := []struct {
+		name    string
+		config  ClientConfig
+		wantErr bool
+	}{
+		{name: "default", config: ClientConfig{Token: token}},
+		{name: "android with token", config: ClientConfig{Token: token, ClientData: &android}},
+		{name: "ios offline", config: ClientConfig{ClientData: &ios}},
+		{name: "ios with token", config: ClientConfig{Token: token, ClientData: &ios}, wantErr: true},
+		{name: "old version offline", config: ClientConfig{ClientData: &oldVersion}},
+		{name: "old version with token", config: ClientConfig{Token: token, ClientData: &oldVersion}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.config.validateClientData()
+			if got := errors.Is(err, ErrUnsupportedClientData); got != tt.wantErr {
+				t.Errorf("validateClientData() = %v, want error %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestDialAddress(t *testing.T) {
+	override := login.ClientData{ServerAddress: "10.0.0.1:19132"}
+	tests := []struct {
+		name        string
+		config      ClientConfig
+		wantNetwork string
+		wantAddress string
+	}{
+		{name: "default", config: ClientConfig{Address: "127.0.0.1:19132"}, wantNetwork: "raknet", wantAddress: "127.0.0.1:19132"},
+		{name: "override", config: ClientConfig{Address: "127.0.0.1:19132", ClientData: &override}, wantNetwork: serverAddressNetwork, wantAddress: "10.0.0.1:19132"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, network, address := tt.config.dialAddress(t.Context())
+			if network != tt.wantNetwork || address != tt.wantAddress {
+				t.Errorf("dialAddress() = %v %v, want %v %v", network, address, tt.wantNetwork, tt.wantAddress)
+			}
+			if dialed, ok := ctx.Value(dialAddressKey{}).(string); network == serverAddressNetwork && dialed != tt.config.Address {
+				t.Errorf("dialed address = %v, want %v", dialed, tt.config.Address)
+			} else if network == "raknet" && ok {
+				t.Errorf("dialed address %v set without override", dialed)
+			}
+		})
+	}
+}
@@ -0,0 +1,134 @@
+package bot
+
+import (
+	"github.com/df-mc/dragonfly/server/block/cube"
+	"github.com/df-mc/dragonfly/server/world"
+	"github.com/df-mc/dragonfly/server/world/chunk"
+)
+
+// lightState is how far the light of a Column has been calculated.
+type lightState uint8
+
+const (
+	// lightNone means the light of the column is not calculated or out of date.
+	lightNone lightState = iota
+	// lightFilled means the light within the column is calculated, without light of its neighbours.
+	lightFilled
+	// lightSpread means light was also spread between the column and all its neighbours.
+	lightSpread
+)
+
+// Light returns the light level at the position passed: the highest of its block light and sky light. Sky
+// light is not dimmed by the time of day, see Client.EffectiveLight for that. Light is calculated with the
+// light engine of dragonfly when first needed after the column or its neighbours changed. Positions in
+// columns that are not loaded have no light.
+func (w *World) Light(pos cube.Pos) uint8 {
+	return w.light(pos, func(c *Column, x uint8, y int16, z uint8) uint8 {
+		return c.Chunk.Light(x, y, z)
+	})
+}
+
+// SkyLight returns the sky light level at the position passed, not dimmed by the time of day.
+func (w *World) SkyLight(pos cube.Pos) uint8 {
+	return w.light(pos, func(c *Column, x uint8, y int16, z uint8) uint8 {
+		return c.Chunk.SkyLight(x, y, z)
+	})
+}
+
+// BlockLight returns the light level emitted by blocks at the position passed.
+func (w *World) BlockLight(pos cube.Pos) uint8 {
+	return w.light(pos, func(c *Column, x uint8, y int16, z uint8) uint8 {
+		return c.SubChunk(y).BlockLight(x&15, uint8(y&15), z&15)
+	})
+}
+
+// light calculates the light of the column at the position passed if needed and reads it with the
+// function passed.
+func (w *World) light(pos cube.Pos, f func(c *Column, x uint8, y int16, z uint8) uint8) uint8 {
+	if w == nil {
+		return 0
+	}
+	if pos[1] > w.r.Max() {
+		return 15
+	} else if pos[1] < w.r.Min() {
+		return 0
+	}
+	c := w.calculateLight(chunkPosFromBlockPos(pos))
+	if c == nil {
+		return 0
+	}
+	c.Lock()
+	defer c.Unlock()
+	return f(c, uint8(pos[0]&15), int16(pos[1]), uint8(pos[2]&15))
+}
+
+// calculateLight fills the light of the column at the position passed and its loaded neighbours, and
+// spreads light between them if all neighbours are loaded. The column is returned, or nil if it is not
+// loaded.
+func (w *World) calculateLight(pos world.ChunkPos) *Column {
+	w.lightMu.Lock()
+	defer w.lightMu.Unlock()
+
+	// The columns around the one passed, ordered as expected by chunk.LightArea.
+	var (
+		area     [9]*Column
+		complete = true
+	)
+	for z := int32(-1); z <= 1; z++ {
+		for x := int32(-1); x <= 1; x++ {
+			c := w.Chunk(world.ChunkPos{pos[0] + x, pos[1] + z})
+			area[(z+1)*3+x+1] = c
+			complete = complete && c != nil
+		}
+	}
+	centre := area[4]
+	if centre == nil || centre.light == lightSpread || (centre.light == lightFilled && !complete) {
+		return centre
+	}
+
+	// The light mutex is held, so no other goroutine locks more than one column at a time.
+	for _, c := range area {
+		if c != nil {
+			c.Lock()
+		}
+	}
+	defer func() {
+		for _, c := range area {
+			if c != nil {
+				c.Unlock()
+			}
+		}
+	}()
+
+	chunks := make([]*chunk.Chunk, 0, len(area))
+	for i, c := range area {
+		if c == nil {
+			continue
+		}
+		if c.light == lightNone {
+			x, z := int(pos[0])-1+i%3, int(pos[1])-1+i/3
+			chunk.LightArea([]*chunk.Chunk{c.Chunk}, x, z).Fill()
+			c.light = lightFilled
+		}
+		chunks = append(chunks, c.Chunk)
+	}
+	if complete {
+		chunk.LightArea(chunks, int(pos[0])-1, int(pos[1])-1).Spread()
+		centre.light = lightSpread
+	}
+	return centre
+}
+
+// invalidateLight marks the light of the column at the position passed and its neighbours, which light
+// may have spread into, as out of date. It must not be called while holding the lock of a column.
+func (w *World) invalidateLight(pos world.ChunkPos) {
+	w.lightMu.Lock()
+	defer w.lightMu.Unlock()
+	for z := int32(-1); z <= 1; z++ {
+		for x := int32(-1); x <= 1; x++ {
+			if c := w.loadedChunk(world.ChunkPos{pos[0] + x, pos[1] + z}); c != nil {
+				c.light = lightNone
+			}
+		}
+	}
+}
@@ -1,53 +1,172 @@
 package bot
 
 import (
-	"github.com/sandertv/gophertunnel/minecraft/protocol/packet"
+	"errors"
+	"fmt"
+	"slices"
 	"sort"
 	"sync"
+
+	"github.com/sandertv/gophertunnel/minecraft/protocol/packet"
 )
 
+// Cancel may be returned by a handler to stop the packet from reaching handlers with a lower priority. It
+// is not reported as an error.
+var Cancel = errors.New("cancel packet handling")
+
 type Events struct {
-	generic  []GenericHandler // for every packet
+	generic  []*Listener // for every packet
 	hLock    sync.Mutex
-	handlers map[uint32][]any // for specific packet id only
+	handlers map[uint32][]*Listener // for specific packet id only
 	tickers  []TickHandler
+
+	outboundGeneric []*Listener            // for every packet written
+	outbound        map[uint32][]*Listener // for specific packet id written only
+
+	// waiters holds the waits added with Expect.
+	waiters waiters
+}
+
+// Listener is a handle to a handler added with AddListener or AddGeneric. It may be used to remove the
+// handler again.
+type Listener struct {
+	e        *Events
+	id       uint32
+	generic  bool
+	priority int
+	once     bool
+	removed  bool
+	f        func(client *Client, p packet.Packet) error
+
+	out func(client *Client, p packet.Packet) (packet.Packet, error)
+}
+
+// Remove removes the handler, so that it is no longer called for any packet. Removing a handler more
+// than once has no effect.
+func (l *Listener) Remove() {
+	l.remove()
+}
+
+// remove removes the handler and reports whether it was still added.
+func (l *Listener) remove() bool {
+	e := l.e
+	e.hLock.Lock()
+	defer e.hLock.Unlock()
+	if l.removed {
+		return false
+	}
+	l.removed = true
+	del := func(o *Listener) bool { return o == l }
+	switch {
+	case l.out != nil && l.generic:
+		e.outboundGeneric = slices.DeleteFunc(slices.Clone(e.outboundGeneric), del)
+	case l.out != nil:
+		e.outbound[l.id] = slices.DeleteFunc(slices.Clone(e.outbound[l.id]), del)
+	case l.generic:
+		e.generic = slices.DeleteFunc(slices.Clone(e.generic), del)
+	default:
+		e.handlers[l.id] = slices.DeleteFunc(slices.Clone(e.handlers[l.id]), del)
+	}
+	return true
 }
 
-func AddListener[T packet.Packet](c *Client, listeners PacketHandler[T]) {
+// AddListener adds a handler called for every packet of type T, in order of priority. The Listener returned
+// may be used to remove it again.
+func AddListener[T packet.Packet](c *Client, listeners PacketHandler[T]) *Listener {
 	e := c.Events
 	var t T
-	id := t.ID()
-
-	if s, ok := e.handlers[id]; !ok {
-		e.handlers[id] = []any{listeners}
-	} else {
-		e.handlers[id] = append(s, listeners)
-		sort.SliceStable(e.handlers[id], func(i, j int) bool {
-			return e.handlers[id][i].(PacketHandler[T]).Priority > e.handlers[id][j].(PacketHandler[T]).Priority
-		})
+	l := &Listener{
+		e:        e,
+		id:       t.ID(),
+		priority: listeners.Priority,
+		once:     listeners.Once,
+		f: func(client *Client, p packet.Packet) error {
+			return listeners.F(client, p.(T))
+		},
 	}
+
+	e.hLock.Lock()
+	defer e.hLock.Unlock()
+	e.handlers[l.id] = insertListener(e.handlers[l.id], l)
+	return l
 }
 
 // AddGeneric adds listeners like AddListener, but the packet ID is ignored.
 // Generic listener is always called before specific packet listener.
-func (e *Events) AddGeneric(listeners ...GenericHandler) {
-	e.generic = append(e.generic, listeners...)
-	sortGenericHandlers(e.generic)
+func (e *Events) AddGeneric(listeners ...GenericHandler) []*Listener {
+	e.hLock.Lock()
+	defer e.hLock.Unlock()
+	added := make([]*Listener, 0, len(listeners))
+	for _, h := range listeners {
+		l := &Listener{e: e, generic: true, priority: h.Priority, once: h.Once, f: h.F}
+		e.generic = insertListener(e.generic, l)
+		added = append(added, l)
+	}
+	return added
 }
 func (e *Events) AddTicker(tickers ...TickHandler) {
+	e.hLock.Lock()
+	defer e.hLock.Unlock()
 	e.tickers = append(e.tickers, tickers...)
 	sortTickHandlers(e.tickers)
 }
 
+// dispatch calls the generic handlers and the handlers of the packet passed in order of priority. A
+// handler returning Cancel stops the packet from reaching the remaining handlers, while any other error is
+// reported and the remaining handlers are still called. The waits added with Expect are matched last,
+// whether the packet was cancelled or not.
+func (e *Events) dispatch(c *Client, pk packet.Packet) {
+	e.hLock.Lock()
+	generic, handlers := e.generic, e.handlers[pk.ID()]
+	e.hLock.Unlock()
+
+	e.handle(c, pk, generic, handlers)
+	e.waiters.notify(pk)
+}
+
+// handle calls the handlers passed in order until one of them cancels the packet.
+func (e *Events) handle(c *Client, pk packet.Packet, generic, handlers []*Listener) {
+	for _, l := range generic {
+		if !e.call(c, l, pk) {
+			return
+		}
+	}
+	for _, l := range handlers {
+		if !e.call(c, l, pk) {
+			return
+		}
+	}
+}
+
+// call calls a single handler and returns false if the handler cancelled the packet.
+func (e *Events) call(c *Client, l *Listener, pk packet.Packet) bool {
+	if l.once && !l.remove() {
+		return true
+	}
+	err := l.f(c, pk)
+	if errors.Is(err, Cancel) {
+		return false
+	}
+	if err != nil {
+		c.Logger.Warnf("handle %T: %v", pk, err)
+		publishEvent(c, &HandlerErrorEvent{Packet: pk, Err: fmt.Errorf("handle %T: %w", pk, err)})
+	}
+	return true
+}
+
 type (
 	PacketHandler[T any] struct {
 		Priority int
-		F        func(client *Client, p T) error
+		// Once removes the handler after it was called for the first time.
+		Once bool
+		F    func(client *Client, p T) error
 	}
 	GenericHandler struct {
 		ID       uint32
 		Priority int
-		F        func(client *Client, p packet.Packet) error
+		// Once removes the handler after it was called for the first time.
+		Once bool
+		F    func(client *Client, p packet.Packet) error
 	}
 	TickHandler struct {
 		Priority int
@@ -55,11 +174,15 @@ type (
 	}
 )
 
-func sortGenericHandlers(slice []GenericHandler) {
-	sort.SliceStable(slice, func(i, j int) bool {
-		return slice[i].Priority > slice[j].Priority
+// insertListener returns a copy of the listeners passed with l inserted after all listeners with the same
+// or a higher priority. A copy is returned so that dispatching never observes a slice being modified.
+func insertListener(listeners []*Listener, l *Listener) []*Listener {
+	i := sort.Search(len(listeners), func(i int) bool {
+		return listeners[i].priority < l.priority
 	})
+	return slices.Insert(slices.Clone(listeners), i, l)
 }
+
 func sortTickHandlers(slice []TickHandler) {
 	sort.SliceStable(slice, func(i, j int) bool {
 		return slice[i].Priority > slice[j].Priority
@@ -0,0 +1,208 @@
+package bot
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"os"
+	"slices"
+	"sync"
+
+	"github.com/df-mc/dragonfly/server/block/cube"
+	"github.com/df-mc/dragonfly/server/item"
+	"github.com/sandertv/gophertunnel/minecraft/protocol"
+	"github.com/sandertv/gophertunnel/minecraft/protocol/packet"
+)
+
+// mapSize is the width and height of a map in pixels.
+const mapSize = 128
+
+// mapIDKey is the NBT key of the ID of a filled map item, also used as key of the value holding it in an
+// item.Stack.
+const mapIDKey = "map_uuid"
+
+// MapData is the state of a map as last sent by the server.
+type MapData struct {
+	ID        int64
+	Dimension int
+	// Origin is the position of the center of the map.
+	Origin cube.Pos
+	Scale  byte
+	Locked bool
+	// Decorations holds the markers shown on the map, such as players and banners.
+	Decorations []protocol.MapDecoration
+}
+
+// mapItem is a map received from the server together with its pixels.
+type mapItem struct {
+	data   MapData
+	pixels *image.RGBA
+}
+
+// mapStore holds all maps received by a client. Map IDs are the same across sessions, so maps are kept
+// when reconnecting.
+type mapStore struct {
+	mu    sync.Mutex
+	items map[int64]*mapItem
+}
+
+// apply applies the update of a map sent in a ClientBoundMapItemData packet.
+func (s *mapStore) apply(p *packet.ClientBoundMapItemData) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	m, ok := s.items[p.MapID]
+	if !ok {
+		m = &mapItem{data: MapData{ID: p.MapID}, pixels: image.NewRGBA(image.Rect(0, 0, mapSize, mapSize))}
+		s.items[p.MapID] = m
+	}
+	if p.UpdateFlags&(packet.MapUpdateFlagTexture|packet.MapUpdateFlagDecoration|packet.MapUpdateFlagInitialisation) != 0 {
+		m.data.Dimension = int(p.Dimension)
+		m.data.Origin = blockPosFromProtocol(p.Origin)
+		m.data.Scale = p.Scale
+		m.data.Locked = p.LockedMap
+	}
+	if p.UpdateFlags&packet.MapUpdateFlagDecoration != 0 {
+		m.data.Decorations = slices.Clone(p.Decorations)
+	}
+	if p.UpdateFlags&packet.MapUpdateFlagTexture != 0 {
+		// Updates may only cover part of the map, starting at the offset.
+		for y := 0; y < int(p.Height); y++ {
+			for x := 0; x < int(p.Width); x++ {
+				i := y*int(p.Width) + x
+				if i >= len(p.Pixels) {
+					return
+				}
+				m.pixels.SetRGBA(int(p.XOffset)+x, int(p.YOffset)+y, p.Pixels[i])
+			}
+		}
+	}
+}
+
+// Map returns the data of the map with the ID passed. False is returned if the map was not received yet.
+func (c *Client) Map(id int64) (MapData, bool) {
+	c.mapItems.mu.Lock()
+	defer c.mapItems.mu.Unlock()
+	m, ok := c.mapItems.items[id]
+	if !ok {
+		return MapData{}, false
+	}
+	data := m.data
+	data.Decorations = slices.Clone(data.Decorations)
+	return data, true
+}
+
+// MapImage returns the pixels of the map with the ID passed, or nil if the map was not received yet. The
+// decorations of the map are not drawn, see MapImageDecorations. Maps may be requested with RequestMap.
+func (c *Client) MapImage(id int64) image.Image {
+	img, _ := c.mapImage(id)
+	if img == nil {
+		return nil
+	}
+	return img
+}
+
+// DecorationDrawer draws a decoration of a map centred on the pixel at x and y of the image passed.
+type DecorationDrawer func(img *image.RGBA, x, y int, d protocol.MapDecoration)
+
+// MapImageDecorations returns the pixels of the map with the ID passed with its decorations drawn on top
+// by the DecorationDrawer passed, or DrawDecorationMarker if nil. Nil is returned if the map was not
+// received yet.
+func (c *Client) MapImageDecorations(id int64, draw DecorationDrawer) image.Image {
+	img, decorations := c.mapImage(id)
+	if img == nil {
+		return nil
+	}
+	if draw == nil {
+		draw = DrawDecorationMarker
+	}
+	for _, d := range decorations {
+		// Decoration positions range from -128 to 127, two per pixel, with 0 at the center of the map.
+		draw(img, (int(int8(d.X))+mapSize)/2, (int(int8(d.Y))+mapSize)/2, d)
+	}
+	return img
+}
+
+// mapImage returns a copy of the pixels and the decorations of the map with the ID passed, or nil if the
+// map was not received yet.
+func (c *Client) mapImage(id int64) (*image.RGBA, []protocol.MapDecoration) {
+	c.mapItems.mu.Lock()
+	defer c.mapItems.mu.Unlock()
+	m, ok := c.mapItems.items[id]
+	if !ok {
+		return nil, nil
+	}
+	img := image.NewRGBA(m.pixels.Rect)
+	copy(img.Pix, m.pixels.Pix)
+	return img, slices.Clone(m.data.Decorations)
+}
+
+// WriteMapPNG writes the image of the map with the ID passed to the writer passed in the PNG format.
+func (c *Client) WriteMapPNG(id int64, w io.Writer) error {
+	img := c.MapImage(id)
+	if img == nil {
+		return fmt.Errorf("map %v not received", id)
+	}
+	return png.Encode(w, img)
+}
+
+// SaveMapPNG writes the image of the map with the ID passed to a PNG file at the path passed.
+func (c *Client) SaveMapPNG(id int64, path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := c.WriteMapPNG(id, f); err != nil {
+		_ = f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// RequestMap asks the server to send the map with the ID passed. Clients send this for maps they do not
+// know yet, for example when holding one.
+func (c *Client) RequestMap(id int64) error {
+	return c.WritePacket(&packet.MapInfoRequest{MapID: id})
+}
+
+// HeldMapImage returns the image of the filled map held by the client. If the map was not received yet,
+// it is requested and nil is returned.
+func (c *Client) HeldMapImage() (image.Image, error) {
+	held, err := c.Screen.Inv.Item(int(c.Screen.HeldSlot.Load()))
+	if err != nil {
+		return nil, err
+	}
+	id, ok := MapID(held)
+	if !ok {
+		return nil, fmt.Errorf("held item is not a filled map")
+	}
+	if img := c.MapImage(id); img != nil {
+		return img, nil
+	}
+	return nil, c.RequestMap(id)
+}
+
+// MapID returns the ID of the map of the filled map item stack passed.
+func MapID(s item.Stack) (int64, bool) {
+	v, ok := s.Value(mapIDKey)
+	if !ok {
+		return 0, false
+	}
+	id, ok := v.(int64)
+	return id, ok
+}
+
+// DrawDecorationMarker is a DecorationDrawer drawing every decoration as a 3x3 square in its colour, or
+// white if it has none, regardless of its type and rotation.
+func DrawDecorationMarker(img *image.RGBA, cx, cy int, d protocol.MapDecoration) {
+	col := d.Colour
+	if col.A == 0 {
+		col = color.RGBA{R: 0xff, G: 0xff, B: 0xff, A: 0xff}
+	}
+	for x := cx - 1; x <= cx+1; x++ {
+		for y := cy - 1; y <= cy+1; y++ {
+			img.SetRGBA(x, y, col)
+		}
+	}
+}
@@ -1,11 +1,9 @@
 package bot
 
 import (
-	"fmt"
 	"iter"
 	"math"
 	"slices"
-	"time"
 
 	"github.com/df-mc/dragonfly/server/block/cube"
 	"github.com/df-mc/dragonfly/server/block/model"
@@ -13,8 +11,6 @@ import (
 	"github.com/fzipp/astar"
 	"github.com/go-gl/mathgl/mgl32"
 	"github.com/go-gl/mathgl/mgl64"
-	"github.com/sandertv/gophertunnel/minecraft/protocol"
-	"github.com/sandertv/gophertunnel/minecraft/protocol/packet"
 )
 
 type Finder[Node cube.Pos] struct {
@@ -107,10 +103,12 @@ func (c *Client) FlyTo(position mgl32.Vec3) {
 func (c *Client) WalkTo(position mgl32.Vec3) {
 	pos := cube.Pos{int(position[0]), int(position[1]), int(position[2])}
 	paths := c.FindPath(pos)
+	ctx := c.Context()
 	for _, path := range paths {
-		c.SendCustomPosition(mgl32.Vec3{float32(path[0]) + 0.5, float32(path[1]) + 1.62, float32(path[2]) + 0.5})
-		fmt.Println(path)
-		time.Sleep(25 * time.Millisecond)
+		c.Self.Position = mgl32.Vec3{float32(path[0]) + 0.5, float32(path[1]) + 1.62, float32(path[2]) + 0.5}
+		if c.WaitTicks(ctx, 0) != nil {
+			return
+		}
 	}
 	c.Self.Position = position
 }
@@ -141,61 +139,43 @@ func FromBlockPos(v mgl32.Vec3) mgl32.Vec3 {
 
 var eyeY = mgl32.Vec3{0, 1.62, 0}
 
+// SendCurrentPosition queues the current position of the player to be sent with the PlayerAuthInput of the
+// next tick.
 func (c *Client) SendCurrentPosition() {
-	c.Conn.WritePacket(&packet.PlayerAuthInput{
-		InputData: protocol.NewBitset(packet.PlayerAuthInputBitsetSize),
-		Position:  c.Self.Position,
-		Pitch:     c.Self.Pitch,
-		Yaw:       c.Self.Yaw,
-		HeadYaw:   c.Self.HeadYaw,
-	})
+	position := c.Self.Position
+	c.queueInput(&position)
 }
 
+// SendInputData queues the input flags passed to be sent with the PlayerAuthInput of the next tick.
 func (c *Client) SendInputData(flags ...int) {
-	inputData := protocol.NewBitset(packet.PlayerAuthInputBitsetSize)
-	for _, flag := range flags {
-		inputData.Set(flag)
-	}
-
-	c.Conn.WritePacket(&packet.PlayerAuthInput{
-		InputData: inputData,
-		Position:  c.Self.Position,
-		Pitch:     c.Self.Pitch,
-		Yaw:       c.Self.Yaw,
-		HeadYaw:   c.Self.HeadYaw,
-	})
+	c.queueInput(nil, flags...)
 }
 
+// SendCustomPosition queues the position passed to be sent instead of the position of the player with the
+// PlayerAuthInput of the next tick.
 func (c *Client) SendCustomPosition(position mgl32.Vec3) {
-	c.Conn.WritePacket(&packet.PlayerAuthInput{
-		InputData: protocol.NewBitset(packet.PlayerAuthInputBitsetSize),
-		Position:  position,
-		Pitch:     c.Self.Pitch,
-		Yaw:       c.Self.Yaw,
-		HeadYaw:   c.Self.HeadYaw,
-	})
+	c.queueInput(&position)
 }
 
+// internalFlyTo moves the player towards the position passed by at most 9 blocks per tick. The positions
+// are sent by the tick loop.
 func (c *Client) internalFlyTo(position mgl32.Vec3) {
+	ctx := c.Context()
 	position = position.Add(eyeY)
 	vector := position.Sub(c.Self.Position)
 	magnitude := vector.Len()
 	for magnitude > 9 {
 		mV := vector.Mul(9 / magnitude)
-		//mV = mV.Mul(10)
 		c.Self.Position = c.Self.Position.Add(mV)
 
-		c.SendCurrentPosition()
-		time.Sleep(50 * time.Millisecond)
-		//c.Player.SetPosition(c.Player.Position.X, c.Player.Position.Y, c.Player.Position.Z)
+		if c.WaitTicks(ctx, 0) != nil {
+			return
+		}
 		vector = position.Sub(c.Self.Position)
 		magnitude = vector.Len()
 	}
-	time.Sleep(50 * time.Millisecond)
 	c.Self.Position = position
-	c.SendCurrentPosition()
-	//c.Player.SetPosition(position.X, position.Y, position.Z)
-	//c.Player.SendCustomPosition(c, position)
+	_ = c.WaitTicks(ctx, 0)
 }
 func vec3Floor(v mgl32.Vec3) mgl32.Vec3 {
 	vec3 := vec32To64(v)
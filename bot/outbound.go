@@ -0,0 +1,163 @@
+package bot
+
+import (
+	"context"
+	"slices"
+	"time"
+
+	"github.com/sandertv/gophertunnel/minecraft/protocol/packet"
+)
+
+// OutboundHandler intercepts packets of type T written with Client.WritePacket, in order of priority like
+// PacketHandler. F returns the packet to pass on to the next handler and eventually the connection: the
+// packet passed to inspect or modify it in place, another packet to replace it, or nil to drop it. To
+// delay the packet, F returns it wrapped with Delay. F must not block, as it runs on the goroutine calling
+// WritePacket, such as the tick loop. An error aborts the write and is returned by WritePacket.
+type OutboundHandler[T any] struct {
+	Priority int
+	F        func(client *Client, p T) (packet.Packet, error)
+}
+
+// AddOutbound adds a handler intercepting packets of type T written by the client. If T is packet.Packet
+// itself, the handler intercepts every packet and is called before the handlers of specific packets. The
+// Listener returned may be used to remove it again.
+func AddOutbound[T packet.Packet](c *Client, h OutboundHandler[T]) *Listener {
+	e := c.Events
+	l := &Listener{
+		e:        e,
+		priority: h.Priority,
+		out: func(client *Client, p packet.Packet) (packet.Packet, error) {
+			pk, ok := p.(T)
+			if !ok {
+				// An earlier handler replaced the packet with one of another type.
+				return p, nil
+			}
+			return h.F(client, pk)
+		},
+	}
+	var t T
+	if any(t) == nil {
+		l.generic = true
+	} else {
+		l.id = t.ID()
+	}
+
+	e.hLock.Lock()
+	defer e.hLock.Unlock()
+	if l.generic {
+		e.outboundGeneric = insertListener(e.outboundGeneric, l)
+	} else {
+		e.outbound[l.id] = insertListener(e.outbound[l.id], l)
+	}
+	return l
+}
+
+// delayedPacket is a packet returned by Delay.
+type delayedPacket struct {
+	packet.Packet
+	delay time.Duration
+}
+
+// Delay may be returned by the F of an OutboundHandler to write the packet passed once the duration passed
+// elapsed, without blocking the caller of WritePacket. Packets written afterwards are held back until the
+// packet was written, so that the server receives all packets in order. Delays of several handlers add up.
+func Delay(pk packet.Packet, d time.Duration) packet.Packet {
+	return &delayedPacket{Packet: pk, delay: d}
+}
+
+// queuedWrite is a packet written by the write loop of a session once at is reached.
+type queuedWrite struct {
+	pk packet.Packet
+	at time.Time
+}
+
+// intercept passes the packet through all outbound handlers and returns the packet to write, or nil if it
+// was dropped, and the time to delay it by.
+func (e *Events) intercept(c *Client, pk packet.Packet) (packet.Packet, time.Duration, error) {
+	e.hLock.Lock()
+	generic, handlers := e.outboundGeneric, e.outbound[pk.ID()]
+	e.hLock.Unlock()
+
+	var (
+		delay time.Duration
+		err   error
+	)
+	for _, l := range append(slices.Clip(generic), handlers...) {
+		if pk, err = l.out(c, pk); err != nil || pk == nil {
+			return nil, 0, err
+		}
+		if d, ok := pk.(*delayedPacket); ok {
+			pk, delay = d.Packet, delay+d.delay
+		}
+	}
+	return pk, delay, nil
+}
+
+// WritePacket passes the packet through the handlers added with AddOutbound and writes it to the
+// connection, unless a handler dropped it. All packets sent by the library go through WritePacket. Packets
+// delayed by a handler, and packets written while those are held back, are queued and written by the
+// session, so WritePacket returns nil for them right away.
+func (c *Client) WritePacket(pk packet.Packet) error {
+	pk, delay, err := c.Events.intercept(c, pk)
+	if err != nil || pk == nil {
+		return err
+	}
+	if c.session != nil && c.session.queueWrite(pk, delay) {
+		return nil
+	}
+	return c.conn.WritePacket(pk)
+}
+
+// queueWrite queues the packet passed to be written by writeLoop once the delay passed elapsed. Packets
+// that are not delayed are only queued if packets queued before were not yet written. False is returned if
+// the packet was not queued and may be written right away.
+func (s *session) queueWrite(pk packet.Packet, delay time.Duration) bool {
+	s.writesMu.Lock()
+	defer s.writesMu.Unlock()
+	if delay <= 0 && len(s.writes) == 0 {
+		return false
+	}
+	s.writes = append(s.writes, queuedWrite{pk: pk, at: time.Now().Add(delay)})
+	select {
+	case s.writeQueued <- struct{}{}:
+	default:
+	}
+	return true
+}
+
+// writeLoop writes the packets queued with queueWrite to the connection passed, in order, until ctx is
+// done. A packet stays queued until it was written, so that packets written meanwhile are queued behind it.
+func (c *Client) writeLoop(ctx context.Context, s *session, conn Conn) {
+	for {
+		s.writesMu.Lock()
+		var next queuedWrite
+		queued := len(s.writes) != 0
+		if queued {
+			next = s.writes[0]
+		}
+		s.writesMu.Unlock()
+
+		if !queued {
+			select {
+			case <-ctx.Done():
+				return
+			case <-s.writeQueued:
+			}
+			continue
+		}
+		t := time.NewTimer(time.Until(next.at))
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return
+		case <-t.C:
+		}
+		if err := conn.WritePacket(next.pk); err != nil {
+			c.Logger.Warnf("write delayed %T: %v", next.pk, err)
+		}
+		s.writesMu.Lock()
+		s.writes[0] = queuedWrite{}
+		s.writes = s.writes[1:]
+		s.writesMu.Unlock()
+	}
+}
@@ -6,7 +6,7 @@ import (
 	"context"
 	"errors"
 	"fmt"
-	"reflect"
+	"net"
 	"sync"
 	"time"
 
@@ -30,11 +30,68 @@ var ErrConnected = errors.New("already connected")
 
 type ClientConfig struct {
 	Address string
-	Token   *oauth2.Token
+	// Token is the Xbox Live token to log in with. If nil, the client logs in offline without
+	// authentication, which is only accepted by servers with authentication disabled, such as the servers
+	// of the bottest package.
+	Token *oauth2.Token
+	// Reconnect enables automatic reconnecting in Run. Nil disables it.
+	Reconnect *ReconnectPolicy
+	// Respawn enables automatic respawning after the client died. Nil disables it.
+	Respawn *RespawnPolicy
+	// ClientData is the client data sent on login, holding the device, input mode, UI profile, language,
+	// skin and persona of the client. ClientDataPreset returns data mimicking real clients. If nil, an
+	// Android client with the zh_TW language is used. Empty fields get the defaults of gophertunnel.
+	// When logging in with a Token, gophertunnel always reports DeviceOS as Android and GameVersion as
+	// the current protocol version, because the token is issued for the Android title, so ConnectTo
+	// returns ErrUnsupportedClientData if other values are set. ServerAddress, if set, is sent instead of
+	// Address, which is still the address dialed. Servers reject it unless it resolves as a UDP address.
+	ClientData *login.ClientData
+	// IdentityData is the identity sent on login. It is only used as is when not logging in with a Token,
+	// as Xbox Live otherwise decides the identity.
+	IdentityData *login.IdentityData
+	// BlobCache, if set, enables the client blob cache: the server sends the hashes of chunk data instead of
+	// the data itself, and only the blobs missing from BlobCache are sent.
+	BlobCache BlobStore
+	// SaveDir, if set, is the directory of a world save the worlds seen by the client are mirrored to while
+	// connected. Columns saved before are loaded in the background the first time they are used, for example
+	// with World.Chunk, so that a restarted client knows the world before the server sends it again. Clients
+	// of a Fleet share their worlds and should not set it.
+	SaveDir string
+	// WorldMemoryLimit, if not 0, is the approximate number of bytes the columns of a World of the client
+	// may use before the least recently used columns are evicted. Columns outside the chunk view of the
+	// client are always evicted, and a World no client uses any longer, such as the World of a dimension
+	// the client left, keeps at most 16 MiB of the columns used last. A World shared by the clients of a
+	// Fleet uses the limit of the client it was created by.
+	WorldMemoryLimit int64
+	// WrapConn, if set, is called with every new connection and the Conn returned is used instead, for
+	// example to record all packets of the session.
+	WrapConn func(conn Conn) (Conn, error)
+}
+
+// Conn is the connection a Client plays on. It is implemented by *minecraft.Conn, and may be implemented
+// by wrappers, for example to record a session, or by a connection replaying a recorded session.
+type Conn interface {
+	ReadPacket() (packet.Packet, error)
+	WritePacket(pk packet.Packet) error
+	Close() error
+	GameData() minecraft.GameData
+	IdentityData() login.IdentityData
+	ClientData() login.ClientData
+	DoSpawnContext(ctx context.Context) error
+}
+
+// ReplayConn is a Conn replaying a recorded session, such as a record.Replay. A client playing on a
+// ReplayConn runs no tick loop or read timeout: ticks are run as the recorded time of the packets read
+// passes, and events are published right away, so that a replay gives the same result every time.
+type ReplayConn interface {
+	Conn
+	// Elapsed returns the time since the start of the recording the last packet returned by ReadPacket was
+	// recorded at.
+	Elapsed() time.Duration
 }
 
 type PlayerStatus struct {
-	connected    bool
+	connected    atomic.Bool
 	flyLock      sync.Mutex
 	breakLock    sync.Mutex
 	teleportChan chan any
@@ -45,14 +102,36 @@ type PlayerStatus struct {
 
 type Client struct {
 	config   ClientConfig
-	Conn     *minecraft.Conn
-	Events   *Events
-	world    *World
-	Logger   *log.Logger
-	Screen   *ScreenManager
-	Entity   *EntityManager
-	Self     *Player
-	EventBus *eventbus.EventBus
+	session  *session
+	clock    scheduler
+	listener *EventsListener
+	// sharedWorld, if set, returns the World shared for a dimension, as set by a Fleet.
+	sharedWorld func(dimension int, r cube.Range) *World
+	mirror      *Mirror
+	// Conn is the connection to the server. It is nil if the client plays on a Conn passed to ConnectConn
+	// that is not a *minecraft.Conn, such as a replay.
+	Conn *minecraft.Conn
+	// conn is the connection the client plays on: Conn, the Conn returned by ClientConfig.WrapConn or the
+	// Conn passed to ConnectConn.
+	conn   Conn
+	Events *Events
+	// world is the World of the current dimension.
+	world *World
+	// worlds holds the World of every dimension the client was in during the session.
+	worlds   map[int]*World
+	worldsMu sync.Mutex
+	mapItems *mapStore
+	// levelTime tracks the time and weather of the level.
+	levelTime *levelTime
+	selfState *selfState
+	Logger    *log.Logger
+	Screen    *ScreenManager
+	Entity    *EntityManager
+	Roster    *Roster
+	Self      *Player
+	EventBus  *eventbus.EventBus
+	// eventWaiters holds the waits added with ExpectEvent.
+	eventWaiters waiters
 
 	*PlayerStatus
 }
@@ -74,17 +153,20 @@ func NewClient() *Client {
 	customFormatter.TimestampFormat = "15:04:05"
 	customFormatter.FullTimestamp = true
 	customFormatter.ForceColors = true
-	customFormatter.ForceColors = true
-	log.SetFormatter(customFormatter)
 	logger.SetFormatter(customFormatter)
 	client := &Client{
 		Events: &Events{
 			hLock:    sync.Mutex{},
-			generic:  []GenericHandler{},
-			handlers: map[uint32][]any{},
+			generic:  []*Listener{},
+			handlers: map[uint32][]*Listener{},
 			tickers:  []TickHandler{},
+			outbound: map[uint32][]*Listener{},
 		},
-		Logger: logger,
+		Logger:    logger,
+		EventBus:  eventbus.New(),
+		mapItems:  &mapStore{items: map[int64]*mapItem{}},
+		levelTime: &levelTime{},
+		selfState: &selfState{},
 		PlayerStatus: &PlayerStatus{
 			flyLock:      sync.Mutex{},
 			breakLock:    sync.Mutex{},
@@ -96,118 +178,181 @@ func NewClient() *Client {
 }
 
 func (c *Client) ConnectTo(config ClientConfig) error {
-	//if c.connected {
-	//	return ErrConnected
-	//}
-	//c.connected = true
+	return c.ConnectToContext(context.Background(), config)
+}
+
+// ConnectToContext dials the server in the config passed. The context only bounds the dial itself; the
+// session that follows is controlled by the context passed to HandleGameContext.
+func (c *Client) ConnectToContext(ctx context.Context, config ClientConfig) error {
+	if err := config.validateClientData(); err != nil {
+		return err
+	}
 	c.config = config
-	tkn := auth.RefreshTokenSource(config.Token)
-	serverConn, err := minecraft.Dialer{
-		TokenSource: tkn,
-		ClientData: login.ClientData{
-			DeviceModel:   "WTF OS 1.0",
-			DeviceOS:      protocol.DeviceAndroid,
-			GameVersion:   "1.20.51",
-			LanguageCode:  "zh_TW",
-			ServerAddress: config.Address,
-		},
-	}.Dial("raknet", config.Address)
+	dialer := minecraft.Dialer{
+		ClientData:        config.clientData(),
+		IdentityData:      config.identityData(),
+		EnableClientCache: config.BlobCache != nil,
+	}
+	if config.Token != nil {
+		dialer.TokenSource = auth.RefreshTokenSource(config.Token)
+	}
+	s := newSession()
+	var dialed atomic.Value[*minecraft.Conn]
+	dialer.PacketFunc = recordPackets(s, func() net.Addr {
+		if conn := dialed.Load(); conn != nil {
+			return conn.RemoteAddr()
+		}
+		return nil
+	})
+	dialCtx, network, address := config.dialAddress(ctx)
+	serverConn, err := dialer.DialContext(dialCtx, network, address)
 	if err != nil {
 		return err
 	}
-	c.Conn = serverConn
+	dialed.Store(serverConn)
+	var conn Conn = serverConn
+	if config.WrapConn != nil {
+		if conn, err = config.WrapConn(conn); err != nil {
+			_ = serverConn.Close()
+			return err
+		}
+	}
+	if config.SaveDir != "" {
+		c.closeMirror()
+		if c.mirror, err = OpenMirror(config.SaveDir); err != nil {
+			_ = conn.Close()
+			return err
+		}
+	}
+	c.connectConn(conn, serverConn, s)
 	return nil
 }
 
+// ConnectConn makes the client play on the connection passed, for example one replaying a recorded
+// session, instead of dialing a server.
+func (c *Client) ConnectConn(conn Conn) {
+	serverConn, _ := conn.(*minecraft.Conn)
+	c.connectConn(conn, serverConn, newSession())
+}
+
+// connectConn makes the client play on the connection passed in the session passed. serverConn is the
+// underlying connection to the server, if any.
+func (c *Client) connectConn(conn Conn, serverConn *minecraft.Conn, s *session) {
+	c.Conn, c.conn = serverConn, conn
+	c.clock.tick.Store(0)
+	c.session = s
+	_, s.replay = conn.(ReplayConn)
+	s.Go(s.dispatch)
+	s.Go(func(ctx context.Context) {
+		c.writeLoop(ctx, s, conn)
+	})
+	c.connected.Store(true)
+}
+
 func (c *Client) HandleGame() error {
-	lastTime := time.Now()
-	exited := atomic.NewBool(false)
-	go func() {
-		ticker := time.NewTicker(15 * time.Second)
-		for {
-			<-ticker.C
-			if time.Now().After(lastTime.Add(time.Second * 15)) {
-				err := c.Conn.Close()
-				c.Conn.Flush()
-				log.Warn("read ", context.DeadlineExceeded, err)
-				exited.Store(true)
-			}
-		}
-	}()
+	return c.HandleGameContext(context.Background())
+}
+
+// HandleGameContext reads and dispatches packets until the session ends. Cancelling ctx disconnects from
+// the server. Every goroutine started for the session is stopped before it returns, and the error
+// returned is always a *SessionError describing why the session ended.
+func (c *Client) HandleGameContext(ctx context.Context) error {
+	s := c.session
+	stop := context.AfterFunc(ctx, func() {
+		s.end(&SessionError{Cause: CauseCancelled, Err: context.Cause(ctx)})
+		_ = c.closeConn("disconnect.disconnected")
+	})
+	defer stop()
+
+	replay, replaying := c.conn.(ReplayConn)
+	lastRead := atomic.NewInt64(time.Now().UnixNano())
+	if !replaying {
+		s.Go(func(ctx context.Context) {
+			c.watchdog(ctx, func() time.Time { return time.Unix(0, lastRead.Load()) })
+		})
+		s.Go(c.tickLoop)
+	}
+	if c.mirror != nil {
+		s.Go(c.mirrorLoop)
+	}
+	var ticked time.Duration
 	for {
-		if exited.Load() {
-			return context.DeadlineExceeded
-		}
-		pk, err := c.Conn.ReadPacket()
+		pk, err := c.conn.ReadPacket()
 		if err != nil {
-			c.connected = false
-			return err
+			s.end(s.errorFromRead(err))
+			break
 		}
-		lastTime = time.Now()
-		id := pk.ID()
-		c.Events.hLock.Lock()
-		handlers := c.Events.handlers[id]
-		c.Events.hLock.Unlock()
-		if len(handlers) > 0 {
-			for _, handler := range handlers {
-				res := reflect.ValueOf(handler).FieldByName("F").Call([]reflect.Value{reflect.ValueOf(c), reflect.ValueOf(pk)})
-				err := res[0].Interface()
-				if err != nil {
-					break
-				}
-			}
-		}
-		for _, handler := range c.Events.generic {
-			err := handler.F(c, pk)
-			if err != nil {
-				break
+		lastRead.Store(time.Now().UnixNano())
+		if replaying {
+			// Ticks that passed in the recording before the packet was read are run before handling it.
+			for ; ticked+tickDuration <= replay.Elapsed(); ticked += tickDuration {
+				c.doTick()
 			}
 		}
+		c.Events.dispatch(c, pk)
 	}
+	c.connected.Store(false)
+	_ = c.conn.Close()
+	c.removeViews()
+	s.wait()
+	c.closeMirror()
+	return s.err()
 }
+
+// Reconnect dials the server of the last config again, completes the spawn sequence if an EventsListener
+// was attached and handles the game until the new session ends.
 func (c *Client) Reconnect() error {
 	err := c.ConnectTo(c.config)
 	if err != nil {
-		panic(err)
+		return err
+	}
+	if c.listener != nil {
+		if err := c.listener.spawn(context.Background(), c); err != nil {
+			_ = c.conn.Close()
+			return err
+		}
 	}
 
-	c.Logger.Infof("Connected as %s\n", c.Conn.IdentityData().Identity)
+	c.Logger.Infof("Connected as %s\n", c.conn.IdentityData().Identity)
 	return c.HandleGame()
 }
 
 func (c *Client) OpenContainer(pos protocol.BlockPos) error {
-	wID := c.Screen.OpenedWindowID.Load()
-	if wID != -1 {
+	ctx, cancel := context.WithTimeout(c.Context(), time.Second*20)
+	defer cancel()
+	return c.OpenContainerContext(ctx, pos)
+}
+
+// OpenContainerContext clicks the container at the position passed until the server opens it or ctx is
+// done. The click is repeated every second in case the server dropped it.
+func (c *Client) OpenContainerContext(ctx context.Context, pos protocol.BlockPos) error {
+	if c.Screen.OpenedWindowID.Load() != -1 {
+		closed := Expect[*packet.ContainerClose](c, nil)
 		c.Screen.CloseCurrentWindow()
-		wID = -1
-		time.Sleep(time.Second)
+		closeCtx, cancel := context.WithTimeout(ctx, time.Second)
+		_, _ = closed.Wait(closeCtx)
+		cancel()
 	}
 	stack, _ := c.Screen.Inv.Item(0)
 
-	c.Self.Yaw = 0
-	c.Self.Pitch = 0
-	c.SendCurrentPosition()
-
-	c.Conn.WritePacket(&packet.InventoryTransaction{
-		TransactionData: &protocol.UseItemTransactionData{
-			ActionType:      protocol.UseItemActionClickBlock,
-			BlockPosition:   protocol.BlockPos{int32(pos.X()), int32(pos.Y()), int32(pos.Z())},
-			BlockFace:       int32(1),
-			ClickedPosition: mgl32.Vec3{0, 0, 0},
-			HeldItem:        InstanceFromItem(stack),
-			HotBarSlot:      0,
-		},
+	opened := Expect[*packet.ContainerOpen](c, func(p *packet.ContainerOpen) bool {
+		return p.WindowID != protocol.WindowIDInventory
 	})
-	ticker := time.NewTicker(time.Millisecond * 1000)
-	for i := 0; i < 20; i++ {
-		<-ticker.C
-		if c.Screen.OpenedWindowID.Load() != wID {
-			return nil
+	defer opened.Cancel()
+	retry := time.NewTicker(time.Second)
+	defer retry.Stop()
+	for {
+		// The rotation is changed on the tick loop, which reads it, and is sent with the input of the tick
+		// after, which has to reach the server first.
+		c.Schedule(0, func(c *Client) {
+			c.Self.Yaw = 0
+			c.Self.Pitch = 0
+			c.SendCurrentPosition()
+		})
+		if err := c.WaitTicks(ctx, 1); err != nil {
+			return fmt.Errorf("container opened timeout %v: %w", pos, err)
 		}
-		c.Self.Yaw = 0
-		c.Self.Pitch = 0
-		c.SendCurrentPosition()
-		c.Conn.WritePacket(&packet.InventoryTransaction{
+		c.WritePacket(&packet.InventoryTransaction{
 			TransactionData: &protocol.UseItemTransactionData{
 				ActionType:      protocol.UseItemActionClickBlock,
 				BlockPosition:   protocol.BlockPos{int32(pos.X()), int32(pos.Y()), int32(pos.Z())},
@@ -217,33 +362,62 @@ func (c *Client) OpenContainer(pos protocol.BlockPos) error {
 				HotBarSlot:      0,
 			},
 		})
+		select {
+		case <-opened.C():
+			return nil
+		case <-ctx.Done():
+			return fmt.Errorf("container opened timeout %v: %w", pos, ctx.Err())
+		case <-retry.C:
+		}
 	}
-	return fmt.Errorf("container opened timeout %v", pos)
 }
 func (c *Client) OpenSystemContainer(command string) error {
-	wID := c.Screen.OpenedWindowID.Load()
+	ctx, cancel := context.WithTimeout(c.Context(), time.Second*10)
+	defer cancel()
+	return c.OpenSystemContainerContext(ctx, command)
+}
+
+// OpenSystemContainerContext sends the command passed and waits until the server opens a container in
+// response, or ctx is done.
+func (c *Client) OpenSystemContainerContext(ctx context.Context, command string) error {
+	opened := Expect[*packet.ContainerOpen](c, func(p *packet.ContainerOpen) bool {
+		return p.WindowID != protocol.WindowIDInventory
+	})
 	err := c.SendCommand(command)
 	if err != nil {
+		opened.Cancel()
 		return err
 	}
+	if _, err := opened.Wait(ctx); err != nil {
+		return fmt.Errorf("container opened timeout, command: %v: %w", command, err)
+	}
+	return nil
+}
 
-	ticker := time.NewTicker(time.Millisecond * 500)
-	for i := 0; i < 20; i++ {
-		<-ticker.C
-		if c.Screen.OpenedWindowID.Load() != wID {
-			return nil
-		}
+// WaitForm blocks until the server sends a form, or ctx is done. It must not be called from an EventBus
+// subscriber, as the form is only published after the subscriber returned.
+func (c *Client) WaitForm(ctx context.Context) (*Form, error) {
+	return AwaitEvent[*Form](ctx, c, nil)
+}
+
+// WaitTeleport blocks until the server teleports the player, or ctx is done, and returns the new position.
+func (c *Client) WaitTeleport(ctx context.Context) (mgl32.Vec3, error) {
+	p, err := Await(ctx, c, func(p *packet.MovePlayer) bool {
+		return p.EntityRuntimeID == c.conn.GameData().EntityRuntimeID && p.Mode == packet.MoveModeTeleport
+	})
+	if err != nil {
+		return mgl32.Vec3{}, err
 	}
-	return fmt.Errorf("container opened timeout, command: %v", command)
+	return p.Position, nil
 }
 func (c *Client) SendText(command string) error {
-	return c.Conn.WritePacket(&packet.Text{
+	return c.WritePacket(&packet.Text{
 		TextType: packet.TextTypeChat,
 		Message:  command,
 	})
 }
 func (c *Client) SendCommand(command string) error {
-	return c.Conn.WritePacket(&packet.CommandRequest{
+	return c.WritePacket(&packet.CommandRequest{
 		CommandLine: command,
 		CommandOrigin: protocol.CommandOrigin{
 			Origin: protocol.CommandOriginPlayer,
@@ -253,9 +427,9 @@ func (c *Client) SendCommand(command string) error {
 	})
 }
 func (c *Client) OpenInventory() {
-	c.Conn.WritePacket(&packet.Interact{
+	c.WritePacket(&packet.Interact{
 		ActionType:            packet.InteractActionOpenInventory,
-		TargetEntityRuntimeID: c.Conn.GameData().EntityRuntimeID,
+		TargetEntityRuntimeID: c.conn.GameData().EntityRuntimeID,
 	})
 }
 
@@ -263,7 +437,7 @@ func (c *Client) PlaceBlock(pos cube.Pos) {
 	hotbarSlot := int(c.Screen.HeldSlot.Load())
 	stack, _ := c.Screen.Inv.Item(hotbarSlot)
 
-	c.Conn.WritePacket(&packet.InventoryTransaction{
+	c.WritePacket(&packet.InventoryTransaction{
 		TransactionData: &protocol.UseItemTransactionData{
 			ActionType:      protocol.UseItemActionClickBlock,
 			BlockPosition:   protocol.BlockPos{int32(pos.X()), int32(pos.Y()), int32(pos.Z())},
@@ -276,19 +450,22 @@ func (c *Client) PlaceBlock(pos cube.Pos) {
 }
 
 func (c *Client) SendFormResponse(data string) {
-	c.Conn.WritePacket(&packet.ModalFormResponse{
+	c.WritePacket(&packet.ModalFormResponse{
 		FormID:       uint32(c.CurrentForm.ID),
 		ResponseData: protocol.Option([]byte(data)),
 	})
 }
 
 func (c *Client) SendFormClose() {
-	c.Conn.WritePacket(&packet.ModalFormResponse{
+	c.WritePacket(&packet.ModalFormResponse{
 		FormID:       uint32(c.CurrentForm.ID),
 		CancelReason: protocol.Option(uint8(packet.ModalFormCancelReasonUserClosed)),
 	})
 }
 
+// BreakBlock breaks the block at the position passed with the held item and returns once the server broke
+// it, or once the time it takes to break it passed. It must not be called from an EventBus subscriber, such
+// as an OnBlockChange callback, as the block is only reported broken after the subscriber returned.
 func (c *Client) BreakBlock(pos cube.Pos) {
 	c.breakLock.Lock()
 	defer c.breakLock.Unlock()
@@ -299,29 +476,20 @@ func (c *Client) BreakBlock(pos cube.Pos) {
 	//	BlockActions: nil,
 	//})
 
-	c.Conn.WritePacket(&packet.PlayerAction{
+	c.WritePacket(&packet.PlayerAction{
 		EntityRuntimeID: c.Self.EntityRuntimeID,
 		ActionType:      protocol.PlayerActionStartBreak,
 		BlockPosition:   bPos,
 		BlockFace:       0,
 	})
 
-	broke := make(chan any, 255)
-	disposable, _ := eventbus.Subscribe[*BrokeBlockEvent](c.EventBus)(func(ctx context.Context, event *BrokeBlockEvent) error {
-		if event.Position == bPos {
-			if c.World().Block(pos) != airB {
-				log.Info(c.World().Block(pos))
-				return nil
-			}
-			go func() {
-				close(broke)
-			}()
-		}
-		return nil
+	broke := ExpectEvent(c, func(event *BrokeBlockEvent) bool {
+		return event.Position == bPos && c.World().Block(pos) == airB
 	})
+	defer broke.Cancel()
 
 	j, _ := c.Screen.Inv.Item(int(c.Screen.HeldSlot.Load()))
-	c.Conn.WritePacket(&packet.InventoryTransaction{
+	c.WritePacket(&packet.InventoryTransaction{
 		TransactionData: &protocol.UseItemTransactionData{
 			ActionType:      protocol.UseItemActionBreakBlock,
 			BlockPosition:   bPos,
@@ -336,12 +504,12 @@ func (c *Client) BreakBlock(pos cube.Pos) {
 	if !c.Self.OnGround {
 		breakTime *= 5
 	}
-	duration := breakTime / 20
+	ticks := int(breakTime/tickDuration) + 1
 
-	t := time.NewTicker(duration)
+	ctx := c.Context()
 F:
-	for i := 0; i < 25; i++ {
-		c.Conn.WritePacket(&packet.PlayerAction{
+	for i := 0; i < ticks*5/4+1; i++ {
+		c.WritePacket(&packet.PlayerAction{
 			EntityRuntimeID: c.Self.EntityRuntimeID,
 			ActionType:      protocol.PlayerActionContinueDestroyBlock,
 			BlockPosition:   bPos,
@@ -349,12 +517,12 @@ F:
 			BlockFace:       0,
 		})
 		select {
-		case <-broke:
+		case <-broke.C():
+			break F
+		case <-ctx.Done():
 			break F
-		case <-t.C:
+		case <-c.After(0):
 			continue
 		}
 	}
-	t.Stop()
-	disposable.Dispose()
 }
@@ -0,0 +1,242 @@
+package bot
+
+import (
+	"iter"
+	"math"
+	"slices"
+
+	"github.com/df-mc/dragonfly/server/block/cube"
+	"github.com/df-mc/dragonfly/server/block/model"
+	"github.com/df-mc/dragonfly/server/world"
+	"github.com/go-gl/mathgl/mgl64"
+)
+
+// BlockName returns a predicate matching blocks with any of the names passed, such as "minecraft:chest".
+func BlockName(names ...string) func(world.Block) bool {
+	return func(b world.Block) bool {
+		name, _ := b.EncodeBlock()
+		return slices.Contains(names, name)
+	}
+}
+
+// SolidBlock checks if the block passed has a collision box and is not a liquid.
+func SolidBlock(b world.Block) bool {
+	if _, ok := b.Model().(model.Empty); ok {
+		return false
+	}
+	_, liquid := b.(world.Liquid)
+	return !liquid
+}
+
+// Blocks iterates over all loaded blocks within the box passed, column by column. Blocks in columns that
+// are not loaded are skipped. The World may be used while iterating.
+func (w *World) Blocks(box cube.BBox) iter.Seq2[cube.Pos, world.Block] {
+	return w.blocks(box, nil)
+}
+
+// blocks iterates over the blocks within the box passed like Blocks. If match is not nil, only matching
+// blocks are yielded, and empty sub chunks are skipped if air does not match.
+func (w *World) blocks(box cube.BBox, match func(world.Block) bool) iter.Seq2[cube.Pos, world.Block] {
+	return func(yield func(cube.Pos, world.Block) bool) {
+		if w == nil {
+			return
+		}
+		minY, maxY := max(int(math.Floor(box.Min()[1])), w.r.Min()), min(int(math.Ceil(box.Max()[1]))-1, w.r.Max())
+		minX, maxX := int(math.Floor(box.Min()[0])), int(math.Ceil(box.Max()[0]))-1
+		minZ, maxZ := int(math.Floor(box.Min()[2])), int(math.Ceil(box.Max()[2]))-1
+		skipEmpty := match != nil && !match(airB)
+
+		type entry struct {
+			pos cube.Pos
+			rid uint32
+		}
+		var entries []entry
+		for cx := minX >> 4; cx <= maxX>>4; cx++ {
+			for cz := minZ >> 4; cz <= maxZ>>4; cz++ {
+				col := w.Chunk(world.ChunkPos{int32(cx), int32(cz)})
+				if col == nil {
+					continue
+				}
+				// Block runtime IDs are collected first, so that the column is not locked while yielding.
+				entries = entries[:0]
+				col.Lock()
+				for y := minY; y <= maxY; y++ {
+					if skipEmpty && col.SubChunk(int16(y)).Empty() {
+						// Skip to the last Y of the sub chunk.
+						y |= 15
+						continue
+					}
+					for x := max(minX, cx<<4); x <= min(maxX, cx<<4|15); x++ {
+						for z := max(minZ, cz<<4); z <= min(maxZ, cz<<4|15); z++ {
+							rid := col.Block(uint8(x), int16(y), uint8(z), 0)
+							entries = append(entries, entry{pos: cube.Pos{x, y, z}, rid: rid})
+						}
+					}
+				}
+				col.Unlock()
+
+				for _, e := range entries {
+					b, _ := world.BlockByRuntimeID(e.rid)
+					if match != nil && !match(b) {
+						continue
+					}
+					if !yield(e.pos, b) {
+						return
+					}
+				}
+			}
+		}
+	}
+}
+
+// FindBlocks returns the positions of all loaded blocks within the radius passed around the center that
+// match, ordered by distance to the center.
+func (w *World) FindBlocks(center cube.Pos, radius int, match func(world.Block) bool) []cube.Pos {
+	var found []cube.Pos
+	for pos := range w.blocks(radiusBox(center, radius), match) {
+		if DistanceTo(pos, center) <= float64(radius) {
+			found = append(found, pos)
+		}
+	}
+	slices.SortStableFunc(found, func(a, b cube.Pos) int {
+		return distanceSq(a, center) - distanceSq(b, center)
+	})
+	return found
+}
+
+// NearestBlock returns the position of the loaded block closest to the center that matches within the
+// radius passed.
+func (w *World) NearestBlock(center cube.Pos, radius int, match func(world.Block) bool) (cube.Pos, bool) {
+	var (
+		nearest cube.Pos
+		best    = radius*radius + 1
+	)
+	for pos := range w.blocks(radiusBox(center, radius), match) {
+		if d := distanceSq(pos, center); d < best {
+			nearest, best = pos, d
+		}
+	}
+	return nearest, best <= radius*radius
+}
+
+// HighestBlock returns the position of the highest solid block at the x and z passed. False is returned if
+// the column is not loaded or holds no solid block.
+func (w *World) HighestBlock(x, z int) (cube.Pos, bool) {
+	if w == nil {
+		return cube.Pos{}, false
+	}
+	col := w.Chunk(chunkPosFromBlockPos(cube.Pos{x, 0, z}))
+	if col == nil {
+		return cube.Pos{}, false
+	}
+	col.Lock()
+	top := min(int(col.Height(uint8(x), uint8(z))), w.r.Max())
+	col.Unlock()
+	for y := top; y >= w.r.Min(); y-- {
+		pos := cube.Pos{x, y, z}
+		if SolidBlock(w.Block(pos)) {
+			return pos, true
+		}
+	}
+	return cube.Pos{}, false
+}
+
+// RaycastResult is the block hit by a raycast.
+type RaycastResult struct {
+	Position cube.Pos
+	// Face is the face of the block that was hit.
+	Face  cube.Face
+	Block world.Block
+}
+
+// Raycast follows the ray from start in the direction passed through the blocks of the World, up to the
+// distance passed, and returns the first solid block hit.
+func (w *World) Raycast(start, direction mgl64.Vec3, distance float64) (RaycastResult, bool) {
+	if w == nil || direction.Len() == 0 {
+		return RaycastResult{}, false
+	}
+	direction = direction.Normalize()
+
+	// Voxel traversal as described by Amanatides and Woo: every iteration steps into the next block along
+	// the axis with the closest block boundary.
+	pos := cube.PosFromVec3(start)
+	var step [3]int
+	var tMax, tDelta [3]float64
+	for i := 0; i < 3; i++ {
+		switch {
+		case direction[i] > 0:
+			step[i] = 1
+			tMax[i] = (float64(pos[i]+1) - start[i]) / direction[i]
+		case direction[i] < 0:
+			step[i] = -1
+			tMax[i] = (float64(pos[i]) - start[i]) / direction[i]
+		default:
+			tMax[i] = math.Inf(1)
+		}
+		tDelta[i] = math.Abs(1 / direction[i])
+	}
+
+	face := cube.FaceUp
+	for t := 0.0; t <= distance; {
+		if b := w.Block(pos); SolidBlock(b) {
+			return RaycastResult{Position: pos, Face: face, Block: b}, true
+		}
+		axis := 0
+		if tMax[1] < tMax[axis] {
+			axis = 1
+		}
+		if tMax[2] < tMax[axis] {
+			axis = 2
+		}
+		t = tMax[axis]
+		pos[axis] += step[axis]
+		tMax[axis] += tDelta[axis]
+		face = enteredFace(axis, step[axis])
+	}
+	return RaycastResult{}, false
+}
+
+// Raycast follows the line of sight of the client up to the distance passed and returns the first solid
+// block it hits.
+func (c *Client) Raycast(distance float64) (RaycastResult, bool) {
+	if c.Self == nil {
+		return RaycastResult{}, false
+	}
+	dir := cube.Rotation{float64(c.Self.Yaw), float64(c.Self.Pitch)}.Vec3()
+	return c.World().Raycast(vec32To64(c.Self.Position), dir, distance)
+}
+
+// enteredFace returns the face through which a block is entered when stepping along the axis passed.
+func enteredFace(axis, step int) cube.Face {
+	switch axis {
+	case 0:
+		if step > 0 {
+			return cube.FaceWest
+		}
+		return cube.FaceEast
+	case 1:
+		if step > 0 {
+			return cube.FaceDown
+		}
+		return cube.FaceUp
+	default:
+		if step > 0 {
+			return cube.FaceNorth
+		}
+		return cube.FaceSouth
+	}
+}
+
+// radiusBox returns the box holding all blocks within the radius passed around the center.
+func radiusBox(center cube.Pos, radius int) cube.BBox {
+	return cube.Box(
+		float64(center[0]-radius), float64(center[1]-radius), float64(center[2]-radius),
+		float64(center[0]+radius+1), float64(center[1]+radius+1), float64(center[2]+radius+1),
+	)
+}
+
+// distanceSq returns the squared distance between two block positions.
+func distanceSq(a, b cube.Pos) int {
+	x, y, z := a[0]-b[0], a[1]-b[1], a[2]-b[2]
+	return x*x + y*y + z*z
+}
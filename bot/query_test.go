@@ -0,0 +1,189 @@
+package bot
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/df-mc/dragonfly/server/block"
+	"github.com/df-mc/dragonfly/server/block/cube"
+	"github.com/df-mc/dragonfly/server/world"
+	"github.com/go-gl/mathgl/mgl64"
+)
+
+// testWorld returns a World with empty columns loaded at all chunk positions from -2 to 1 on both axes and
+// stone placed at every position passed.
+func testWorld(stone ...cube.Pos) *World {
+	w := NewWorld(world.Overworld.Range())
+	for x := int32(-2); x <= 1; x++ {
+		for z := int32(-2); z <= 1; z++ {
+			testColumns(w, 0, world.ChunkPos{x, z})
+		}
+	}
+	for _, pos := range stone {
+		w.swapBlock(pos, 0, world.BlockRuntimeID(block.Stone{}))
+	}
+	return w
+}
+
+func TestRaycast(t *testing.T) {
+	tests := []struct {
+		name      string
+		stone     []cube.Pos
+		start     mgl64.Vec3
+		direction mgl64.Vec3
+		distance  float64
+		want      cube.Pos
+		face      cube.Face
+		miss      bool
+	}{
+		{
+			name:      "inside block",
+			stone:     []cube.Pos{{0, 0, 0}},
+			start:     mgl64.Vec3{0.5, 0.5, 0.5},
+			direction: mgl64.Vec3{1, 0, 0},
+			distance:  5,
+			want:      cube.Pos{0, 0, 0},
+			face:      cube.FaceUp,
+		},
+		{
+			name:      "across chunk border",
+			stone:     []cube.Pos{{17, 0, 0}, {18, 0, 0}},
+			start:     mgl64.Vec3{14.5, 0.5, 0.5},
+			direction: mgl64.Vec3{1, 0, 0},
+			distance:  5,
+			want:      cube.Pos{17, 0, 0},
+			face:      cube.FaceWest,
+		},
+		{
+			name:      "negative x",
+			stone:     []cube.Pos{{-3, 0, 0}},
+			start:     mgl64.Vec3{0.5, 0.5, 0.5},
+			direction: mgl64.Vec3{-1, 0, 0},
+			distance:  5,
+			want:      cube.Pos{-3, 0, 0},
+			face:      cube.FaceEast,
+		},
+		{
+			name:      "across sub chunk border",
+			stone:     []cube.Pos{{0, 14, 0}},
+			start:     mgl64.Vec3{0.5, 17.5, 0.5},
+			direction: mgl64.Vec3{0, -1, 0},
+			distance:  5,
+			want:      cube.Pos{0, 14, 0},
+			face:      cube.FaceUp,
+		},
+		{
+			name:      "negative y",
+			stone:     []cube.Pos{{0, -2, 0}},
+			start:     mgl64.Vec3{0.5, 2.5, 0.5},
+			direction: mgl64.Vec3{0, -1, 0},
+			distance:  5,
+			want:      cube.Pos{0, -2, 0},
+			face:      cube.FaceUp,
+		},
+		{
+			name:      "diagonal into negative chunk",
+			stone:     []cube.Pos{{-17, 0, -17}},
+			start:     mgl64.Vec3{-0.25, 0.5, -0.75},
+			direction: mgl64.Vec3{-1, 0, -1},
+			distance:  30,
+			want:      cube.Pos{-17, 0, -17},
+			face:      cube.FaceEast,
+		},
+		{
+			name:      "beyond distance",
+			stone:     []cube.Pos{{10, 0, 0}},
+			start:     mgl64.Vec3{0.5, 0.5, 0.5},
+			direction: mgl64.Vec3{1, 0, 0},
+			distance:  5,
+			miss:      true,
+		},
+		{
+			name:     "no direction",
+			stone:    []cube.Pos{{0, 0, 0}},
+			start:    mgl64.Vec3{0.5, 0.5, 0.5},
+			distance: 5,
+			miss:     true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res, ok := testWorld(tt.stone...).Raycast(tt.start, tt.direction, tt.distance)
+			if ok == tt.miss {
+				t.Fatalf("Raycast() hit %v, want %v", ok, !tt.miss)
+			}
+			if !ok {
+				return
+			}
+			if res.Position != tt.want || res.Face != tt.face {
+				t.Errorf("Raycast() = %v through %v, want %v through %v", res.Position, res.Face, tt.want, tt.face)
+			}
+			if _, ok := res.Block.(block.Stone); !ok {
+				t.Errorf("Raycast() hit %T, want block.Stone", res.Block)
+			}
+		})
+	}
+}
+
+func TestBlocks(t *testing.T) {
+	tests := []struct {
+		name string
+		box  cube.BBox
+		// unload holds the positions of columns removed before iterating.
+		unload []world.ChunkPos
+		want   int
+	}{
+		{name: "single block", box: cube.Box(0, 0, 0, 1, 1, 1), want: 1},
+		{name: "across chunk borders", box: cube.Box(-2, 0, -2, 2, 2, 2), want: 32},
+		// Blocks partially within the box are yielded too.
+		{name: "fractional box", box: cube.Box(-0.5, 0.5, -0.5, 0.5, 1.5, 0.5), want: 8},
+		{name: "column not loaded", box: cube.Box(-2, 0, -2, 2, 2, 2), unload: []world.ChunkPos{{0, -1}}, want: 24},
+		{name: "below range", box: cube.Box(0, -100, 0, 1, -60, 1), want: 4},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := testWorld()
+			for _, pos := range tt.unload {
+				w.chunkMutex.Lock()
+				delete(w.chunks, pos)
+				w.chunkMutex.Unlock()
+			}
+			n := 0
+			for pos, b := range w.Blocks(tt.box) {
+				if !tt.box.IntersectsWith(cube.Box(0, 0, 0, 1, 1, 1).Translate(pos.Vec3())) {
+					t.Errorf("yielded %v outside of %v", pos, tt.box)
+				}
+				if b != airB {
+					t.Errorf("yielded %T at %v, want air", b, pos)
+				}
+				n++
+			}
+			if n != tt.want {
+				t.Errorf("yielded %v blocks, want %v", n, tt.want)
+			}
+		})
+	}
+}
+
+func TestFindBlocks(t *testing.T) {
+	stone := []cube.Pos{{3, 0, 0}, {-1, 0, 0}, {0, 0, -2}, {5, 0, 0}, {-16, 1, 0}, {2, 2, 2}}
+	tests := []struct {
+		name   string
+		center cube.Pos
+		radius int
+		want   []cube.Pos
+	}{
+		{name: "ordered by distance", radius: 4, want: []cube.Pos{{-1, 0, 0}, {0, 0, -2}, {3, 0, 0}, {2, 2, 2}}},
+		{name: "within radius only", radius: 2, want: []cube.Pos{{-1, 0, 0}, {0, 0, -2}}},
+		{name: "negative center", center: cube.Pos{-15, 0, 0}, radius: 2, want: []cube.Pos{{-16, 1, 0}}},
+		{name: "none", center: cube.Pos{0, 10, 0}, radius: 3},
+	}
+	w := testWorld(stone...)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if found := w.FindBlocks(tt.center, tt.radius, SolidBlock); !slices.Equal(found, tt.want) {
+				t.Errorf("FindBlocks() = %v, want %v", found, tt.want)
+			}
+		})
+	}
+}
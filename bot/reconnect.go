@@ -0,0 +1,152 @@
+package bot
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"time"
+)
+
+// ErrReconnectExhausted is returned by Run when the ReconnectPolicy ran out of attempts.
+var ErrReconnectExhausted = errors.New("reconnect attempts exhausted")
+
+// ReconnectPolicy controls how Run reconnects after a session ends. The zero value retries forever,
+// starting with a one second delay that doubles up to a minute.
+type ReconnectPolicy struct {
+	// MaxAttempts is the amount of consecutive attempts after which Run gives up. Attempts are consecutive
+	// until a session stays up for ResetAfter, so that failing to connect and losing the session right
+	// after connecting both count. Zero means no limit.
+	MaxAttempts int
+	// ResetAfter is how long a session has to stay up for the attempts before it to be forgotten, so that
+	// the next attempt starts at InitialBackoff again. Defaults to one minute.
+	ResetAfter time.Duration
+	// InitialBackoff is the delay before the first attempt. Defaults to one second.
+	InitialBackoff time.Duration
+	// MaxBackoff caps the delay between attempts. Defaults to one minute.
+	MaxBackoff time.Duration
+	// Multiplier is the factor the delay grows by after every failed attempt. Defaults to 2.
+	Multiplier float64
+	// Jitter randomises every delay by up to this fraction of it, in both directions. It should be
+	// between 0 and 1.
+	Jitter float64
+	// RetryOnKick decides whether to reconnect after being kicked with the message passed. If nil, the
+	// client always reconnects after a kick.
+	RetryOnKick func(message string) bool
+}
+
+// shouldRetry checks if a session that ended with the error passed should be reconnected.
+func (p *ReconnectPolicy) shouldRetry(err *SessionError) bool {
+	switch err.Cause {
+	case CauseCancelled:
+		return false
+	case CauseKicked:
+		return p.RetryOnKick == nil || p.RetryOnKick(err.Message)
+	}
+	return true
+}
+
+// resetAfter returns how long a session has to stay up for the attempts before it to be forgotten.
+func (p *ReconnectPolicy) resetAfter() time.Duration {
+	if p.ResetAfter <= 0 {
+		return time.Minute
+	}
+	return p.ResetAfter
+}
+
+// next returns the attempt following the amount of consecutive attempts passed and the delay before it.
+// It returns false if the policy ran out of attempts.
+func (p *ReconnectPolicy) next(attempts int) (int, time.Duration, bool) {
+	attempt := attempts + 1
+	if p.MaxAttempts != 0 && attempt > p.MaxAttempts {
+		return 0, 0, false
+	}
+	return attempt, p.backoff(attempt), true
+}
+
+// backoff returns the delay before the attempt passed, starting at 1.
+func (p *ReconnectPolicy) backoff(attempt int) time.Duration {
+	initial, maxBackoff, multiplier := p.InitialBackoff, p.MaxBackoff, p.Multiplier
+	if initial <= 0 {
+		initial = time.Second
+	}
+	if maxBackoff <= 0 {
+		maxBackoff = time.Minute
+	}
+	if multiplier < 1 {
+		multiplier = 2
+	}
+	d := math.Min(float64(initial)*math.Pow(multiplier, float64(attempt-1)), float64(maxBackoff))
+	if p.Jitter > 0 {
+		d += d * p.Jitter * (rand.Float64()*2 - 1)
+	}
+	return time.Duration(d)
+}
+
+// Run handles the game on the current connection and, if ClientConfig.Reconnect is set, reconnects every
+// time the session ends until ctx is cancelled, the policy refuses to retry or it runs out of attempts.
+// Listeners added with AddListener and subscriptions on the EventBus are kept across reconnects, while
+// World, EntityManager and ScreenManager state is rebuilt for every new session.
+func (c *Client) Run(ctx context.Context) error {
+	// attempts is the amount of consecutive attempts to reconnect, kept until a session stays up long enough.
+	var attempts int
+	for {
+		started := time.Now()
+		err := c.HandleGameContext(ctx)
+		var sErr *SessionError
+		if !errors.As(err, &sErr) {
+			return err
+		}
+		_ = publishNow(ctx, c, &DisconnectedEvent{Err: sErr})
+
+		policy := c.config.Reconnect
+		if policy == nil || ctx.Err() != nil || !policy.shouldRetry(sErr) {
+			return err
+		}
+		if time.Since(started) >= policy.resetAfter() {
+			attempts = 0
+		}
+		if attempts, err = c.reconnect(ctx, policy, attempts); err != nil {
+			return err
+		}
+	}
+}
+
+// reconnect dials the server again until it succeeds or the policy runs out of attempts. attempts is the
+// amount of consecutive attempts made before, and the amount including the attempt that succeeded is
+// returned.
+func (c *Client) reconnect(ctx context.Context, policy *ReconnectPolicy, attempts int) (int, error) {
+	for {
+		attempt, delay, ok := policy.next(attempts)
+		if !ok {
+			return attempts, fmt.Errorf("%w after %v attempts", ErrReconnectExhausted, policy.MaxAttempts)
+		}
+		attempts = attempt
+		_ = publishNow(ctx, c, &ReconnectingEvent{Attempt: attempt, Delay: delay})
+
+		t := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return attempts, ctx.Err()
+		case <-t.C:
+		}
+
+		if err := c.ConnectToContext(ctx, c.config); err != nil {
+			c.Logger.Warnf("reconnect attempt %v failed: %v", attempt, err)
+			continue
+		}
+		if c.listener != nil {
+			if err := c.listener.spawn(ctx, c); err != nil {
+				c.Logger.Warnf("reconnect attempt %v failed to spawn: %v", attempt, err)
+				c.session.end(&SessionError{Cause: CauseNetwork, Err: err})
+				_ = c.conn.Close()
+				continue
+			}
+		}
+		c.Logger.Infof("Reconnected as %s", c.conn.IdentityData().DisplayName)
+		_ = publishNow(ctx, c, &ReconnectedEvent{Attempt: attempt})
+		return attempts, nil
+	}
+}
@@ -0,0 +1,85 @@
+package bot
+
+import (
+	"testing"
+	"time"
+)
+
+func TestReconnectPolicyNext(t *testing.T) {
+	tests := []struct {
+		name   string
+		policy ReconnectPolicy
+		// start is the amount of attempts made before.
+		start int
+		want  []time.Duration
+	}{
+		{
+			name:   "defaults",
+			policy: ReconnectPolicy{MaxAttempts: 9},
+			want:   []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 8 * time.Second, 16 * time.Second, 32 * time.Second, time.Minute, time.Minute, time.Minute},
+		},
+		{
+			name:   "multiplier and max backoff",
+			policy: ReconnectPolicy{MaxAttempts: 4, InitialBackoff: 100 * time.Millisecond, MaxBackoff: time.Second, Multiplier: 3},
+			want:   []time.Duration{100 * time.Millisecond, 300 * time.Millisecond, 900 * time.Millisecond, time.Second},
+		},
+		{
+			name:   "continued after earlier attempts",
+			policy: ReconnectPolicy{MaxAttempts: 5},
+			start:  3,
+			want:   []time.Duration{8 * time.Second, 16 * time.Second},
+		},
+		{
+			name:   "exhausted",
+			policy: ReconnectPolicy{MaxAttempts: 2},
+			start:  2,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []time.Duration
+			for attempts := tt.start; ; {
+				attempt, delay, ok := tt.policy.next(attempts)
+				if !ok {
+					break
+				}
+				if attempt != attempts+1 {
+					t.Fatalf("attempt after %v = %v, want %v", attempts, attempt, attempts+1)
+				}
+				attempts = attempt
+				got = append(got, delay)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("delays = %v, want %v", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("delays = %v, want %v", got, tt.want)
+					break
+				}
+			}
+		})
+	}
+}
+
+func TestReconnectPolicyJitter(t *testing.T) {
+	policy := ReconnectPolicy{InitialBackoff: time.Second, Jitter: 0.25}
+	for attempt := 1; attempt <= 3; attempt++ {
+		base := time.Second << (attempt - 1)
+		low, high := base-base/4, base+base/4
+		for range 100 {
+			if d := policy.backoff(attempt); d < low || d > high {
+				t.Fatalf("backoff(%v) = %v, want between %v and %v", attempt, d, low, high)
+			}
+		}
+	}
+}
+
+func TestReconnectPolicyResetAfter(t *testing.T) {
+	if d := (&ReconnectPolicy{}).resetAfter(); d != time.Minute {
+		t.Errorf("default resetAfter() = %v, want %v", d, time.Minute)
+	}
+	if d := (&ReconnectPolicy{ResetAfter: time.Second}).resetAfter(); d != time.Second {
+		t.Errorf("resetAfter() = %v, want %v", d, time.Second)
+	}
+}
@@ -0,0 +1,114 @@
+package record
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/sandertv/gophertunnel/minecraft/protocol"
+	"github.com/sandertv/gophertunnel/minecraft/protocol/packet"
+)
+
+// Reader reads the records of a recording one by one.
+type Reader struct {
+	r        *bufio.Reader
+	header   Header
+	shieldID int32
+
+	serverPool, clientPool packet.Pool
+}
+
+// NewReader reads the header of the recording in r and returns a Reader for its records.
+func NewReader(r io.Reader) (*Reader, error) {
+	rd := &Reader{r: bufio.NewReader(r), serverPool: packet.NewServerPool(), clientPool: packet.NewClientPool()}
+
+	head := make([]byte, len(magic)+1)
+	if _, err := io.ReadFull(rd.r, head); err != nil {
+		return nil, fmt.Errorf("read magic: %w", err)
+	}
+	if string(head[:len(magic)]) != magic {
+		return nil, fmt.Errorf("not a recording: magic %q", head[:len(magic)])
+	}
+	if head[len(magic)] != version {
+		return nil, fmt.Errorf("unsupported recording version %v", head[len(magic)])
+	}
+	n, err := binary.ReadUvarint(rd.r)
+	if err != nil {
+		return nil, fmt.Errorf("read header length: %w", err)
+	}
+	data := make([]byte, n)
+	if _, err := io.ReadFull(rd.r, data); err != nil {
+		return nil, fmt.Errorf("read header: %w", err)
+	}
+	if err := json.Unmarshal(data, &rd.header); err != nil {
+		return nil, fmt.Errorf("decode header: %w", err)
+	}
+	rd.shieldID = shieldID(rd.header.GameData.Items)
+	return rd, nil
+}
+
+// Header returns the header of the recording.
+func (rd *Reader) Header() Header {
+	return rd.header
+}
+
+// Next reads the next record. It returns io.EOF once all records were read.
+func (rd *Reader) Next() (Record, error) {
+	dir, err := rd.r.ReadByte()
+	if err != nil {
+		return Record{}, err
+	}
+	t, err := binary.ReadVarint(rd.r)
+	if err != nil {
+		return Record{}, fmt.Errorf("read time: %w", io.ErrUnexpectedEOF)
+	}
+	id, err := binary.ReadUvarint(rd.r)
+	if err != nil {
+		return Record{}, fmt.Errorf("read packet ID: %w", io.ErrUnexpectedEOF)
+	}
+	n, err := binary.ReadUvarint(rd.r)
+	if err != nil {
+		return Record{}, fmt.Errorf("read payload length: %w", io.ErrUnexpectedEOF)
+	}
+	payload := make([]byte, n)
+	if _, err := io.ReadFull(rd.r, payload); err != nil {
+		return Record{}, fmt.Errorf("read payload: %w", io.ErrUnexpectedEOF)
+	}
+
+	pool := rd.serverPool
+	if Direction(dir) == Outbound {
+		pool = rd.clientPool
+	}
+	pk, err := rd.decode(pool, uint32(id), payload)
+	if err != nil {
+		return Record{}, err
+	}
+	if reg, ok := pk.(*packet.ItemRegistry); ok {
+		rd.shieldID = shieldID(reg.Items)
+	}
+	return Record{Time: time.Duration(t), Direction: Direction(dir), Packet: pk}, nil
+}
+
+// decode decodes the payload of a packet with the ID passed using the pool passed.
+func (rd *Reader) decode(pool packet.Pool, id uint32, payload []byte) (pk packet.Packet, err error) {
+	if f, ok := pool[id]; ok {
+		pk = f()
+	} else {
+		pk = &packet.Unknown{PacketID: id}
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("decode packet %T: %v", pk, r)
+		}
+	}()
+	buf := bytes.NewBuffer(payload)
+	pk.Marshal(protocol.NewReader(buf, rd.shieldID, false))
+	if buf.Len() != 0 {
+		return nil, fmt.Errorf("decode packet %T: %v unread bytes left", pk, buf.Len())
+	}
+	return pk, nil
+}
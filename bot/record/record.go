@@ -0,0 +1,157 @@
+// Package record captures the packets of a bot.Client session to a file and replays them later, so that
+// the handlers of the bot package can be run against real sessions without a server.
+//
+// A recording starts with the magic bytes "BLREC", a format version byte and a length prefixed JSON
+// Header. Every record that follows holds a direction byte, the time since the start of the recording in
+// nanoseconds as varint, the packet ID as uvarint and the length prefixed packet payload.
+package record
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/patyhank/bedrock-library/bot"
+	"github.com/sandertv/gophertunnel/minecraft"
+	"github.com/sandertv/gophertunnel/minecraft/protocol"
+	"github.com/sandertv/gophertunnel/minecraft/protocol/login"
+	"github.com/sandertv/gophertunnel/minecraft/protocol/packet"
+)
+
+const (
+	magic   = "BLREC"
+	version = 1
+)
+
+// Direction is the direction a recorded packet was sent in.
+type Direction byte
+
+const (
+	// Inbound packets were sent by the server.
+	Inbound Direction = iota
+	// Outbound packets were sent by the client.
+	Outbound
+)
+
+// Header holds the data of the connection a recording was made on.
+type Header struct {
+	GameData     minecraft.GameData
+	IdentityData login.IdentityData
+	ClientData   login.ClientData
+}
+
+// Record is a single packet of a recording.
+type Record struct {
+	// Time is the time since the start of the recording the packet was read or written at.
+	Time      time.Duration
+	Direction Direction
+	Packet    packet.Packet
+}
+
+// Recorder is a bot.Conn that writes every packet read from or written to the connection it wraps to a
+// recording. It may be returned from bot.ClientConfig.WrapConn.
+type Recorder struct {
+	bot.Conn
+
+	mu       sync.Mutex
+	w        *bufio.Writer
+	start    time.Time
+	shieldID int32
+	buf      bytes.Buffer
+	err      error
+}
+
+// NewRecorder writes the header of conn to w and returns a Recorder recording all packets of conn to w.
+// Closing the Recorder flushes the recording, but does not close w.
+func NewRecorder(conn bot.Conn, w io.Writer) (*Recorder, error) {
+	r := &Recorder{Conn: conn, w: bufio.NewWriter(w), start: time.Now(), shieldID: shieldID(conn.GameData().Items)}
+	if err := writeHeader(r.w, Header{GameData: conn.GameData(), IdentityData: conn.IdentityData(), ClientData: conn.ClientData()}); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// ReadPacket reads a packet from the connection and records it.
+func (r *Recorder) ReadPacket() (packet.Packet, error) {
+	pk, err := r.Conn.ReadPacket()
+	if err == nil {
+		r.record(Inbound, pk)
+	}
+	return pk, err
+}
+
+// WritePacket records the packet and writes it to the connection.
+func (r *Recorder) WritePacket(pk packet.Packet) error {
+	r.record(Outbound, pk)
+	return r.Conn.WritePacket(pk)
+}
+
+// Close flushes the recording and closes the connection.
+func (r *Recorder) Close() error {
+	r.mu.Lock()
+	err := r.w.Flush()
+	r.mu.Unlock()
+	return errors.Join(r.Conn.Close(), err)
+}
+
+// Err returns the first error encountered writing the recording.
+func (r *Recorder) Err() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.err
+}
+
+// record writes a single record. Errors are kept and returned by Err, so that a failing recording never
+// breaks the session.
+func (r *Recorder) record(dir Direction, pk packet.Packet) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.err != nil {
+		return
+	}
+	if reg, ok := pk.(*packet.ItemRegistry); ok {
+		r.shieldID = shieldID(reg.Items)
+	}
+	r.buf.Reset()
+	pk.Marshal(protocol.NewWriter(&r.buf, r.shieldID))
+
+	var scratch [binary.MaxVarintLen64]byte
+	_ = r.w.WriteByte(byte(dir))
+	_, _ = r.w.Write(scratch[:binary.PutVarint(scratch[:], int64(time.Since(r.start)))])
+	_, _ = r.w.Write(scratch[:binary.PutUvarint(scratch[:], uint64(pk.ID()))])
+	_, _ = r.w.Write(scratch[:binary.PutUvarint(scratch[:], uint64(r.buf.Len()))])
+	if _, err := r.w.Write(r.buf.Bytes()); err != nil {
+		r.err = fmt.Errorf("write record: %w", err)
+	}
+}
+
+// writeHeader writes the magic, version and header to w.
+func writeHeader(w *bufio.Writer, h Header) error {
+	data, err := json.Marshal(h)
+	if err != nil {
+		return fmt.Errorf("encode header: %w", err)
+	}
+	var scratch [binary.MaxVarintLen64]byte
+	_, _ = w.WriteString(magic)
+	_ = w.WriteByte(version)
+	_, _ = w.Write(scratch[:binary.PutUvarint(scratch[:], uint64(len(data)))])
+	_, _ = w.Write(data)
+	return w.Flush()
+}
+
+// shieldID returns the runtime ID of the shield item in the item entries passed, which is needed to
+// encode and decode item stacks.
+func shieldID(items []protocol.ItemEntry) int32 {
+	for _, it := range items {
+		if it.Name == "minecraft:shield" {
+			return int32(it.RuntimeID)
+		}
+	}
+	return 0
+}
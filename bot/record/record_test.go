@@ -0,0 +1,170 @@
+package record_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/df-mc/dragonfly/server/block"
+	"github.com/df-mc/dragonfly/server/block/cube"
+	"github.com/df-mc/dragonfly/server/item"
+	"github.com/df-mc/dragonfly/server/world"
+	"github.com/df-mc/dragonfly/server/world/chunk"
+	"github.com/go-gl/mathgl/mgl32"
+	"github.com/patyhank/bedrock-library/bot"
+	"github.com/patyhank/bedrock-library/bot/bottest"
+	"github.com/patyhank/bedrock-library/bot/record"
+	"github.com/sandertv/gophertunnel/minecraft/protocol"
+	"github.com/sandertv/gophertunnel/minecraft/protocol/packet"
+)
+
+// state is the part of the state of a client compared between a session and its replay.
+type state struct {
+	block    world.Block
+	entity   *bot.Entity
+	item     item.Stack
+	windowID int32
+	tick     uint64
+}
+
+// snapshot returns the state of the client passed.
+func snapshot(c *bot.Client, pos cube.Pos, rID uint64) state {
+	it, _ := c.Screen.Inv.Item(0)
+	return state{
+		block:    c.World().Block(pos),
+		entity:   c.Entity.GetEntity(rID),
+		item:     it,
+		windowID: c.Screen.OpenedWindowID.Load(),
+		tick:     c.Tick(),
+	}
+}
+
+func TestRecordReplay(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*30)
+	defer cancel()
+
+	srv, err := bottest.NewServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Close()
+
+	buf := bytes.NewBuffer(nil)
+	var recorder *record.Recorder
+	config := srv.Config()
+	config.WrapConn = func(conn bot.Conn) (bot.Conn, error) {
+		r, err := record.NewRecorder(conn, buf)
+		if err != nil {
+			return nil, err
+		}
+		recorder = r
+		return r, nil
+	}
+	c, p, err := srv.ConnectConfig(ctx, bottest.DefaultGameData(), config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gameCtx, stop := context.WithCancel(ctx)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		_ = c.HandleGameContext(gameCtx)
+	}()
+
+	pos, rID := cube.Pos{1, 64, 1}, uint64(5)
+	air, _ := chunk.StateToRuntimeID("minecraft:air", nil)
+	ch := chunk.New(air, world.Overworld.Range())
+	ch.SetBlock(uint8(pos.X()), int16(pos.Y()), uint8(pos.Z()), 0, world.BlockRuntimeID(block.Dirt{}))
+	content := make([]protocol.ItemInstance, 36)
+	for i := range content {
+		content[i] = bot.InstanceFromItem(item.Stack{})
+	}
+	content[0] = protocol.ItemInstance{StackNetworkID: 1, Stack: bot.StackFromItem(item.NewStack(item.Diamond{}, 3))}
+
+	if err := p.SendChunk(world.ChunkPos{0, 0}, ch); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.WritePacket(&packet.AddActor{
+		EntityUniqueID:  int64(rID),
+		EntityRuntimeID: rID,
+		EntityType:      "minecraft:zombie",
+		Position:        mgl32.Vec3{3, 64, 3},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.SendInventory(protocol.WindowIDInventory, content); err != nil {
+		t.Fatal(err)
+	}
+	// Let some ticks pass, so that the replay has to run them.
+	if err := c.WaitTicks(ctx, 5); err != nil {
+		t.Fatal(err)
+	}
+	opened := bot.Expect[*packet.ContainerOpen](c, nil)
+	if err := p.OpenContainer(1, protocol.ContainerTypeContainer, protocol.BlockPos{2, 64, 0}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := opened.Wait(ctx); err != nil {
+		t.Fatal(err)
+	}
+	stop()
+	<-done
+	if err := recorder.Err(); err != nil {
+		t.Fatal(err)
+	}
+	live := snapshot(c, pos, rID)
+
+	// The replay runs a tick for every tick that passed before the last inbound packet was recorded.
+	rd, err := record.NewReader(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var last time.Duration
+	for {
+		rec, err := rd.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		} else if err != nil {
+			t.Fatal(err)
+		}
+		if rec.Direction == record.Inbound {
+			last = rec.Time
+		}
+	}
+
+	replay, err := record.NewReplay(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	replayed := bot.NewClient()
+	replayed.ConnectConn(replay)
+	if err := (bot.EventsListener{}).AttachContext(ctx, replayed); err != nil {
+		t.Fatal(err)
+	}
+	_ = replayed.HandleGameContext(ctx)
+	got := snapshot(replayed, pos, rID)
+
+	if got.block != (block.Dirt{}) || got.block != live.block {
+		t.Errorf("replayed block = %#v, live %#v, want dirt", got.block, live.block)
+	}
+	if got.entity == nil || live.entity == nil {
+		t.Fatalf("replayed entity = %v, live %v, want both", got.entity, live.entity)
+	}
+	if got.entity.EntityType != live.entity.EntityType || got.entity.Position != live.entity.Position {
+		t.Errorf("replayed entity %v at %v, live %v at %v", got.entity.EntityType, got.entity.Position, live.entity.EntityType, live.entity.Position)
+	}
+	if !got.item.Comparable(live.item) || got.item.Count() != live.item.Count() || live.item.Count() != 3 {
+		t.Errorf("replayed slot 0 = %v, live %v, want 3 diamonds", got.item, live.item)
+	}
+	if got.windowID != 1 || got.windowID != live.windowID {
+		t.Errorf("replayed window ID = %v, live %v, want 1", got.windowID, live.windowID)
+	}
+	if want := uint64(last / (time.Second / 20)); got.tick != want {
+		t.Errorf("replayed tick = %v, want %v", got.tick, want)
+	}
+	if got.tick < 5 {
+		t.Errorf("replayed tick = %v, want at least the 5 ticks waited for", got.tick)
+	}
+}
@@ -0,0 +1,131 @@
+package record
+
+import (
+	"context"
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/sandertv/gophertunnel/minecraft"
+	"github.com/sandertv/gophertunnel/minecraft/protocol/login"
+	"github.com/sandertv/gophertunnel/minecraft/protocol/packet"
+)
+
+// Replay is a bot.ReplayConn that feeds the inbound packets of a recording to a bot.Client as fast as they
+// are read. The client runs its ticks by the recorded time of the packets instead of the wall clock, so that
+// the result does not depend on timing. Packets written by the client are collected and may be compared to
+// the outbound packets of the recording. ReadPacket returns io.EOF once the recording ends, which ends the
+// session.
+//
+//	replay, _ := record.NewReplay(f)
+//	c := bot.NewClient()
+//	c.ConnectConn(replay)
+//	(&bot.EventsListener{}).Attach(c)
+//	_ = c.HandleGame()
+//	// Assert on c.World(), c.Entity and c.Screen.
+type Replay struct {
+	rd *Reader
+
+	mu       sync.Mutex
+	closed   bool
+	recorded []Record
+	written  []packet.Packet
+	// elapsed is the recorded time of the last inbound packet returned.
+	elapsed time.Duration
+}
+
+// NewReplay reads the header of the recording in r and returns a Replay of it.
+func NewReplay(r io.Reader) (*Replay, error) {
+	rd, err := NewReader(r)
+	if err != nil {
+		return nil, err
+	}
+	return &Replay{rd: rd}, nil
+}
+
+// ReadPacket returns the next inbound packet of the recording.
+func (r *Replay) ReadPacket() (packet.Packet, error) {
+	for {
+		r.mu.Lock()
+		closed := r.closed
+		r.mu.Unlock()
+		if closed {
+			return nil, net.ErrClosed
+		}
+		rec, err := r.rd.Next()
+		if err != nil {
+			return nil, err
+		}
+		if rec.Direction == Inbound {
+			r.mu.Lock()
+			r.elapsed = rec.Time
+			r.mu.Unlock()
+			return rec.Packet, nil
+		}
+		r.mu.Lock()
+		r.recorded = append(r.recorded, rec)
+		r.mu.Unlock()
+	}
+}
+
+// Elapsed returns the time since the start of the recording the last packet returned by ReadPacket was
+// recorded at.
+func (r *Replay) Elapsed() time.Duration {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.elapsed
+}
+
+// WritePacket collects the packet written by the client.
+func (r *Replay) WritePacket(pk packet.Packet) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.closed {
+		return net.ErrClosed
+	}
+	r.written = append(r.written, pk)
+	return nil
+}
+
+// Written returns all packets written by the client so far.
+func (r *Replay) Written() []packet.Packet {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]packet.Packet(nil), r.written...)
+}
+
+// Recorded returns the outbound records of the recording that were passed while replaying so far.
+func (r *Replay) Recorded() []Record {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]Record(nil), r.recorded...)
+}
+
+// Close stops the replay.
+func (r *Replay) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.closed = true
+	return nil
+}
+
+// GameData returns the game data of the recorded connection.
+func (r *Replay) GameData() minecraft.GameData {
+	return r.rd.header.GameData
+}
+
+// IdentityData returns the identity data of the recorded connection.
+func (r *Replay) IdentityData() login.IdentityData {
+	return r.rd.header.IdentityData
+}
+
+// ClientData returns the client data of the recorded connection.
+func (r *Replay) ClientData() login.ClientData {
+	return r.rd.header.ClientData
+}
+
+// DoSpawnContext returns immediately, as the recording starts after the spawn sequence.
+func (r *Replay) DoSpawnContext(context.Context) error {
+	return nil
+}
@@ -0,0 +1,165 @@
+package bot
+
+import (
+	"context"
+	"math"
+	"time"
+
+	"github.com/go-gl/mathgl/mgl32"
+	"github.com/goxiaoy/go-eventbus"
+	"github.com/sandertv/gophertunnel/minecraft/protocol"
+	"github.com/sandertv/gophertunnel/minecraft/protocol/packet"
+)
+
+// RespawnPolicy controls how the client recovers from dying when set as ClientConfig.Respawn. The zero
+// value respawns one second after dying.
+type RespawnPolicy struct {
+	// Delay is the time waited after dying before respawning. Defaults to one second.
+	Delay time.Duration
+	// Timeout is the time waited for the server to respawn the client before giving up. Defaults to ten
+	// seconds.
+	Timeout time.Duration
+	// Command, if set, is run once the client respawned and its state was sent to the server again, for
+	// example /back.
+	Command string
+	// OnDeath, if set, is called with every death right before respawning.
+	OnDeath func(d Death)
+}
+
+// Death describes a death of the client.
+type Death struct {
+	Position  mgl32.Vec3
+	Dimension int
+	// Cause is the cause of death sent by the server, such as attack.player. It is empty if the server did
+	// not send it.
+	Cause string
+	Time  time.Time
+}
+
+// Respawn asks the server to respawn the client after dying, like pressing the respawn button. A
+// RespawnedEvent is published once the server respawned the client.
+func (c *Client) Respawn() error {
+	if err := c.WritePacket(&packet.PlayerAction{
+		EntityRuntimeID: c.Self.EntityRuntimeID,
+		ActionType:      protocol.PlayerActionRespawn,
+	}); err != nil {
+		return err
+	}
+	return c.WritePacket(&packet.Respawn{
+		State:           packet.RespawnStateClientReadyToSpawn,
+		EntityRuntimeID: c.Self.EntityRuntimeID,
+	})
+}
+
+// handleDeaths respawns the client every time it dies if ClientConfig.Respawn is set.
+func (c *Client) handleDeaths() {
+	_, _ = eventbus.Subscribe[*DiedEvent](c.EventBus)(func(ctx context.Context, e *DiedEvent) error {
+		policy := c.config.Respawn
+		if policy == nil || c.session == nil {
+			return nil
+		}
+		// The EventBus is locked while publishing, so recovering, which waits for other events, is done in
+		// the background.
+		c.session.Go(func(ctx context.Context) {
+			c.recoverDeath(ctx, policy, e)
+		})
+		return nil
+	})
+}
+
+// recoverDeath respawns the client after the death passed, re-syncs its state and runs the command of the
+// policy.
+func (c *Client) recoverDeath(ctx context.Context, policy *RespawnPolicy, e *DiedEvent) {
+	delay, timeout := policy.Delay, policy.Timeout
+	if delay <= 0 {
+		delay = time.Second
+	}
+	if timeout <= 0 {
+		timeout = time.Second * 10
+	}
+	t := time.NewTimer(delay)
+	select {
+	case <-ctx.Done():
+		t.Stop()
+		return
+	case <-t.C:
+	}
+
+	state := c.State()
+	if !state.Dead {
+		// The server respawned the client already, for example because of instant respawn.
+		return
+	}
+	if policy.OnDeath != nil {
+		policy.OnDeath(Death{Position: e.Position, Dimension: c.Dimension(), Cause: state.DeathCause, Time: time.Now()})
+	}
+
+	respawned := ExpectEvent[*RespawnedEvent](c, nil)
+	if err := c.Respawn(); err != nil {
+		respawned.Cancel()
+		c.Logger.Warnf("failed to respawn: %v", err)
+		return
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	r, err := respawned.Wait(ctx)
+	if err != nil {
+		c.Logger.Warnf("server did not respawn the client: %v", err)
+		return
+	}
+
+	// Give the server time to send the inventory and chunks around the respawn position.
+	if err := c.WaitTicks(ctx, 10); err != nil {
+		return
+	}
+	if err := c.resync(ctx, r.Position); err != nil {
+		return
+	}
+	if policy.Command != "" {
+		if err := c.SendCommand(policy.Command); err != nil {
+			c.Logger.Warnf("failed to run %v after respawning: %v", policy.Command, err)
+		}
+	}
+}
+
+// resync sends the state of the client to the server again after respawning at the position passed: windows
+// open before dying are closed, the inventory and chunk radius are requested again, and the position and held
+// item are sent. It returns once the position was sent, or with an error if ctx is done first.
+func (c *Client) resync(ctx context.Context, pos mgl32.Vec3) error {
+	if c.Screen.ContainerOpened.Load() {
+		c.Screen.CloseCurrentWindow()
+	}
+	c.resyncInventory(ctx)
+
+	radius := c.conn.GameData().ChunkRadius
+	if err := c.WritePacket(&packet.RequestChunkRadius{ChunkRadius: radius, MaxChunkRadius: uint8(min(radius, math.MaxUint8))}); err != nil {
+		c.Logger.Warnf("failed to request chunk radius: %v", err)
+	}
+
+	// The position is changed on the tick loop, which reads it, and sent with the input of the next tick.
+	c.Schedule(0, func(c *Client) {
+		c.Self.Position = pos
+		c.SendCurrentPosition()
+	})
+	c.Screen.SetCarriedItem(int(c.Screen.HeldSlot.Load()))
+	return c.WaitTicks(ctx, 1)
+}
+
+// resyncInventory opens and closes the inventory of the client, so that the server sends its content again.
+// Servers that do not open the inventory within a second are not waited for any longer.
+func (c *Client) resyncInventory(ctx context.Context) {
+	ctx, cancel := context.WithTimeout(ctx, time.Second)
+	defer cancel()
+
+	opened := Expect[*packet.ContainerOpen](c, func(p *packet.ContainerOpen) bool {
+		return p.WindowID == protocol.WindowIDInventory
+	})
+	c.OpenInventory()
+	if _, err := opened.Wait(ctx); err != nil {
+		c.Logger.Debugf("server did not open the inventory: %v", err)
+		return
+	}
+	closed := Expect[*packet.ContainerClose](c, nil)
+	c.Screen.CloseCurrentWindow()
+	_, _ = closed.Wait(ctx)
+}
@@ -0,0 +1,175 @@
+package bot
+
+import (
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/sandertv/gophertunnel/minecraft/protocol"
+	"github.com/sandertv/gophertunnel/minecraft/protocol/packet"
+)
+
+// RosterEntry is a player in the player list of the server.
+type RosterEntry struct {
+	UUID           uuid.UUID
+	EntityUniqueID int64
+	XUID           string
+	Username       string
+	// SkinID is the ID of the skin of the player.
+	SkinID string
+	// PlatformChatID is the ID of the player on the platform it plays on, only set for some platforms.
+	PlatformChatID string
+	// BuildPlatform is the device OS of the player, such as protocol.DeviceAndroid.
+	BuildPlatform int32
+	// Added is the time the player was added to the player list.
+	Added time.Time
+}
+
+// Roster holds all players in the player list of the server, which are usually all online players,
+// including those out of range of the client. It is safe for concurrent use.
+type Roster struct {
+	mu      sync.Mutex
+	entries map[uuid.UUID]RosterEntry
+}
+
+// NewRoster returns an empty Roster.
+func NewRoster() *Roster {
+	return &Roster{entries: map[uuid.UUID]RosterEntry{}}
+}
+
+// apply applies a PlayerList packet to the roster and returns the entries that were added and removed.
+// Entries added again, for example to update the skin, are not returned.
+func (r *Roster) apply(p *packet.PlayerList) (added, removed []RosterEntry) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, entry := range p.Entries {
+		old, ok := r.entries[entry.UUID]
+		switch p.ActionType {
+		case packet.PlayerListActionAdd:
+			e := rosterEntry(entry)
+			if ok {
+				e.Added = old.Added
+			} else {
+				added = append(added, e)
+			}
+			r.entries[entry.UUID] = e
+		case packet.PlayerListActionRemove:
+			if ok {
+				delete(r.entries, entry.UUID)
+				removed = append(removed, old)
+			}
+		}
+	}
+	return added, removed
+}
+
+// rosterEntry returns the RosterEntry of a player list entry added.
+func rosterEntry(entry protocol.PlayerListEntry) RosterEntry {
+	return RosterEntry{
+		UUID:           entry.UUID,
+		EntityUniqueID: entry.EntityUniqueID,
+		XUID:           entry.XUID,
+		Username:       entry.Username,
+		SkinID:         entry.Skin.SkinID,
+		PlatformChatID: entry.PlatformChatID,
+		BuildPlatform:  entry.BuildPlatform,
+		Added:          time.Now(),
+	}
+}
+
+// Players returns all players in the roster, ordered by username.
+func (r *Roster) Players() []RosterEntry {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	entries := make([]RosterEntry, 0, len(r.entries))
+	for _, e := range r.entries {
+		entries = append(entries, e)
+	}
+	slices.SortFunc(entries, func(a, b RosterEntry) int {
+		return strings.Compare(strings.ToLower(a.Username), strings.ToLower(b.Username))
+	})
+	return entries
+}
+
+// Player returns the player with the UUID passed. False is returned if it is not in the roster.
+func (r *Roster) Player(id uuid.UUID) (RosterEntry, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	e, ok := r.entries[id]
+	return e, ok
+}
+
+// ByName returns the player with the username passed, ignoring case. False is returned if it is not in the
+// roster.
+func (r *Roster) ByName(username string) (RosterEntry, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, e := range r.entries {
+		if strings.EqualFold(e.Username, username) {
+			return e, true
+		}
+	}
+	return RosterEntry{}, false
+}
+
+// ByXUID returns the player with the XUID passed. False is returned if it is not in the roster.
+func (r *Roster) ByXUID(xuid string) (RosterEntry, bool) {
+	if xuid == "" {
+		return RosterEntry{}, false
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, e := range r.entries {
+		if e.XUID == xuid {
+			return e, true
+		}
+	}
+	return RosterEntry{}, false
+}
+
+// Len returns the number of players in the roster.
+func (r *Roster) Len() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.entries)
+}
+
+// OnlinePlayer is a player of the Roster together with its Player entity.
+type OnlinePlayer struct {
+	RosterEntry
+	// Entity is the Player entity of the player, or nil if the player is not in range of the client.
+	Entity *EntitySnapshot
+}
+
+// OnlinePlayers returns all players in the Roster, with the Player entities of those in range of the
+// client.
+func (c *Client) OnlinePlayers() []OnlinePlayer {
+	entities := map[uuid.UUID]EntitySnapshot{}
+	for _, e := range c.Entity.Entities(EntityFilter{Types: []string{"minecraft:player"}}) {
+		entities[e.Player.UUID] = e
+	}
+	entries := c.Roster.Players()
+	players := make([]OnlinePlayer, len(entries))
+	for i, entry := range entries {
+		players[i] = OnlinePlayer{RosterEntry: entry}
+		if e, ok := entities[entry.UUID]; ok {
+			players[i].Entity = &e
+		}
+	}
+	return players
+}
+
+// PlayerEntity returns the Player entity of the player with the UUID passed. False is returned if the
+// player is not in range of the client.
+func (c *Client) PlayerEntity(id uuid.UUID) (EntitySnapshot, bool) {
+	found := c.Entity.Entities(EntityFilter{
+		Types: []string{"minecraft:player"},
+		Match: func(e EntitySnapshot) bool { return e.Player.UUID == id },
+	})
+	if len(found) == 0 {
+		return EntitySnapshot{}, false
+	}
+	return found[0], true
+}
@@ -0,0 +1,203 @@
+package bot
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/df-mc/dragonfly/server/block/cube"
+	"github.com/df-mc/dragonfly/server/world"
+	"github.com/df-mc/dragonfly/server/world/chunk"
+	"github.com/df-mc/dragonfly/server/world/mcdb"
+	"github.com/df-mc/goleveldb/leveldb"
+)
+
+// saveInterval is the interval at which changed columns are written to the Mirror of a client.
+const saveInterval = time.Second * 10
+
+// Mirror writes Worlds to a world save in the LevelDB format of Minecraft, which can be opened by
+// dragonfly, map tools and Minecraft itself, and reads them back to warm start a World.
+type Mirror struct {
+	db *mcdb.DB
+}
+
+// OpenMirror opens the world save in the directory passed, creating it if it does not exist. Only one
+// Mirror may have a directory open at a time.
+func OpenMirror(dir string) (*Mirror, error) {
+	db, err := mcdb.Open(dir)
+	if err != nil {
+		return nil, fmt.Errorf("open world save: %w", err)
+	}
+	return &Mirror{db: db}, nil
+}
+
+// Load reads all columns of the dimension of the World passed from the save into it. Columns already in
+// the World are kept.
+func (m *Mirror) Load(w *World) error {
+	dim, ok := world.DimensionByID(w.dimension)
+	if !ok {
+		return fmt.Errorf("load world: unknown dimension %v", w.dimension)
+	}
+	iter := m.db.NewColumnIterator(&mcdb.IteratorRange{Dimension: dim})
+	defer iter.Release()
+	for iter.Next() {
+		col := iter.Column()
+		if col.Chunk.Range() != w.r {
+			continue
+		}
+		w.chunkMutex.Lock()
+		if _, ok := w.chunks[iter.Position()]; !ok {
+			w.chunks[iter.Position()] = newColumn(col.Chunk, blockEntityMap(col.BlockEntities))
+		}
+		w.chunkMutex.Unlock()
+	}
+	return iter.Error()
+}
+
+// mirror makes the World passed load missing columns from the save in the background of the current session
+// of the client passed, so that a large save is neither read at once nor on the read loop. Columns missing
+// after the session ended are not loaded any longer.
+func (m *Mirror) mirror(c *Client, w *World) {
+	s, log := c.session, c.Logger
+	w.load = func(pos world.ChunkPos) {
+		s.Go(func(ctx context.Context) {
+			col, err := m.loadColumn(w, pos)
+			if err != nil {
+				log.Warnf("Failed to load chunk %v: %v", pos, err)
+			}
+			w.finishLoad(pos, col)
+		})
+	}
+}
+
+// loadColumn reads the column at the position passed of the dimension of the World passed from the save. nil
+// is returned if the save does not hold it.
+func (m *Mirror) loadColumn(w *World, pos world.ChunkPos) (*chunk.Column, error) {
+	dim, ok := world.DimensionByID(w.dimension)
+	if !ok {
+		return nil, fmt.Errorf("load world: unknown dimension %v", w.dimension)
+	}
+	col, err := m.db.LoadColumn(pos, dim)
+	if errors.Is(err, leveldb.ErrNotFound) {
+		return nil, nil
+	}
+	if err != nil || col.Chunk.Range() != w.r {
+		return nil, err
+	}
+	return col, nil
+}
+
+// blockEntityMap returns the block entities passed by their position.
+func blockEntityMap(blockEntities []chunk.BlockEntity) map[cube.Pos]map[string]any {
+	m := make(map[cube.Pos]map[string]any, len(blockEntities))
+	for _, b := range blockEntities {
+		m[b.Pos] = b.Data
+	}
+	return m
+}
+
+// Flush writes all columns of the World passed that changed since the last Flush to the save.
+func (m *Mirror) Flush(w *World) error {
+	return m.store(w, false)
+}
+
+// store writes the columns of the World passed to the save, or only those changed if all is false.
+func (m *Mirror) store(w *World, all bool) error {
+	w.chunkMutex.Lock()
+	columns := make(map[world.ChunkPos]*Column, len(w.chunks))
+	for pos, c := range w.chunks {
+		columns[pos] = c
+	}
+	w.chunkMutex.Unlock()
+	return m.storeColumns(w.dimension, columns, all)
+}
+
+// storeColumns writes the columns passed of the dimension passed to the save, or only those changed if all
+// is false.
+func (m *Mirror) storeColumns(dimension int, columns map[world.ChunkPos]*Column, all bool) error {
+	dim, ok := world.DimensionByID(dimension)
+	if !ok {
+		return fmt.Errorf("save world: unknown dimension %v", dimension)
+	}
+	var errs []error
+	for pos, c := range columns {
+		c.Lock()
+		if all || c.dirty {
+			col := &chunk.Column{Chunk: c.Chunk}
+			for bPos, data := range c.BlockEntities {
+				col.BlockEntities = append(col.BlockEntities, chunk.BlockEntity{Pos: bPos, Data: data})
+			}
+			if err := m.db.StoreColumn(pos, dim, col); err != nil {
+				errs = append(errs, fmt.Errorf("store column %v: %w", pos, err))
+			} else {
+				c.dirty = false
+			}
+		}
+		c.Unlock()
+	}
+	return errors.Join(errs...)
+}
+
+// Close closes the save.
+func (m *Mirror) Close() error {
+	return m.db.Close()
+}
+
+// Save writes all columns of the World to the world save in the directory passed.
+func (w *World) Save(dir string) error {
+	m, err := OpenMirror(dir)
+	if err != nil {
+		return err
+	}
+	return errors.Join(m.store(w, true), m.Close())
+}
+
+// LoadWorld reads the columns of the dimension passed from the world save in the directory passed.
+func LoadWorld(dir string, dimension int) (*World, error) {
+	dim, ok := world.DimensionByID(dimension)
+	if !ok {
+		return nil, fmt.Errorf("load world: unknown dimension %v", dimension)
+	}
+	m, err := OpenMirror(dir)
+	if err != nil {
+		return nil, err
+	}
+	w := NewWorld(dim.Range())
+	w.dimension = dimension
+	return w, errors.Join(m.Load(w), m.Close())
+}
+
+// mirrorLoop writes the changed columns of the worlds of the client to its Mirror until ctx is done.
+func (c *Client) mirrorLoop(ctx context.Context) {
+	t := time.NewTicker(saveInterval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+			for _, w := range c.allWorlds() {
+				if err := c.mirror.Flush(w); err != nil {
+					c.Logger.Warnf("Failed to save world: %v", err)
+				}
+			}
+		}
+	}
+}
+
+// closeMirror writes the changed columns of the worlds of the client to its Mirror and closes it.
+func (c *Client) closeMirror() {
+	if c.mirror == nil {
+		return
+	}
+	for _, w := range c.allWorlds() {
+		if err := c.mirror.Flush(w); err != nil {
+			c.Logger.Warnf("Failed to save world: %v", err)
+		}
+	}
+	if err := c.mirror.Close(); err != nil {
+		c.Logger.Warnf("Failed to close world save: %v", err)
+	}
+	c.mirror = nil
+}
@@ -0,0 +1,52 @@
+package bot
+
+import (
+	"testing"
+
+	"github.com/df-mc/dragonfly/server/block"
+	"github.com/df-mc/dragonfly/server/block/cube"
+	"github.com/df-mc/dragonfly/server/world"
+)
+
+func TestMirrorLoadsLazily(t *testing.T) {
+	dir := t.TempDir()
+	r := world.Overworld.Range()
+	pos, missing := world.ChunkPos{1, -1}, world.ChunkPos{0, 0}
+	stone := cube.Pos{16, 0, -16}
+
+	saved := NewWorld(r)
+	testColumns(saved, 0, pos)
+	saved.swapBlock(stone, 0, world.BlockRuntimeID(block.Stone{}))
+	if err := saved.Save(dir); err != nil {
+		t.Fatal(err)
+	}
+
+	m, err := OpenMirror(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Close()
+	c := NewClient()
+	c.session, c.mirror = newSession(), m
+
+	w := c.newWorld(0, r)
+	if n := w.Stats().Chunks; n != 0 {
+		t.Fatalf("%v columns loaded before use, want 0", n)
+	}
+	for _, p := range []world.ChunkPos{pos, missing} {
+		if w.Chunk(p) != nil {
+			t.Errorf("column %v loaded on the first use, want in the background", p)
+		}
+	}
+	// The columns are loaded on the session, which waits for them.
+	c.session.wait()
+	if n := len(w.loading); n != 0 {
+		t.Errorf("%v columns still loading, want 0", n)
+	}
+	if b, ok := w.Block(stone).(block.Stone); !ok {
+		t.Errorf("block at %v = %v, want %v", stone, w.Block(stone), b)
+	}
+	if w.Chunk(missing) != nil {
+		t.Errorf("column %v loaded, but not saved", missing)
+	}
+}
@@ -2,7 +2,6 @@ package bot
 
 import (
 	_ "embed"
-	"fmt"
 	"slices"
 	"strings"
 
@@ -75,7 +74,7 @@ func NewManager(client *Client) *ScreenManager {
 
 	AddListener(client, PacketHandler[*packet.ContainerOpen]{
 		F: func(client *Client, p *packet.ContainerOpen) error {
-			fmt.Println(p.WindowID)
+			client.Logger.Debugf("Container opened: window %v", p.WindowID)
 			m.OpenedWindowID.Store(int32(p.WindowID))
 			if p.WindowID == protocol.WindowIDInventory {
 				return nil
@@ -91,9 +90,10 @@ func NewManager(client *Client) *ScreenManager {
 				m.OpenedWindow.Store(invBlock)
 			}
 			if p.ContainerEntityUniqueID != -1 {
-				entity := m.c.Entity.GetEntity(uint64(p.ContainerEntityUniqueID))
+				rID, _ := m.c.Entity.RuntimeID(p.ContainerEntityUniqueID)
+				entity := m.c.Entity.GetEntity(rID)
 				if entity != nil {
-					switch m.c.Entity.GetEntity(uint64(p.ContainerEntityUniqueID)).EntityType {
+					switch entity.EntityType {
 					case "minecraft:villager_v2":
 						m.OpenedWindow.Store(inventory.New(3, func(slot int, before, after item.Stack) {}))
 					}
@@ -197,6 +197,23 @@ func NewManager(client *Client) *ScreenManager {
 	return m
 }
 
+// reset clears all inventory and window state, as is needed after connecting to a new session.
+func (m *ScreenManager) reset() {
+	m.Inv.Clear()
+	m.OffHand.Clear()
+	m.EnderChest.Clear()
+	m.UI.Clear()
+	m.Armour.Clear()
+	m.ContainerOpened.Store(false)
+	m.OpenedWindowID.Store(0)
+	m.OpenedContainerID.Store(-1)
+	m.OpenedWindow.Store(nil)
+	m.OpenedPos.Store(cube.Pos{})
+	m.HeldSlot.Store(0)
+	m.HeldItem.Store(item.Stack{})
+	m.handler = &itemStackRequestHandler{changes: map[byte]map[byte]changeInfo{}, responseChanges: map[int32]map[*inventory.Inventory]map[byte]responseChange{}}
+}
+
 type ActionConfig struct {
 	SourceContainerID    int
 	RemoteContainerID    int
@@ -854,12 +871,12 @@ func (m *ScreenManager) SendContainerClick(request *packet.ItemStackRequest) err
 	if err != nil {
 		return err
 	}
-	return m.c.Conn.WritePacket(request)
+	return m.c.WritePacket(request)
 }
 
 // CloseCurrentWindow 關閉目前視窗
 func (m *ScreenManager) CloseCurrentWindow() {
-	m.c.Conn.WritePacket(&packet.ContainerClose{
+	m.c.WritePacket(&packet.ContainerClose{
 		WindowID:   byte(m.OpenedWindowID.Load()),
 		ServerSide: false,
 	})
@@ -874,7 +891,7 @@ func (m *ScreenManager) SetCarriedItem(s int) {
 	}
 	stack, _ := m.Inv.Item(s)
 
-	m.c.Conn.WritePacket(&packet.MobEquipment{
+	m.c.WritePacket(&packet.MobEquipment{
 		EntityRuntimeID: m.c.Self.EntityRuntimeID,
 		NewItem:         InstanceFromItem(stack),
 		InventorySlot:   0,
@@ -1028,6 +1045,13 @@ func StackFromItem(it item.Stack) protocol.ItemStack {
 
 	rid, meta, _ := world.ItemRuntimeID(it.Item())
 
+	// The map ID is kept as a value of the stack, but must be sent as NBT of its own.
+	mapID, hasMapID := it.Value(mapIDKey)
+	nbtData := nbtconv.WriteItem(it.WithValue(mapIDKey, nil), false)
+	if hasMapID {
+		nbtData[mapIDKey] = mapID
+	}
+
 	return protocol.ItemStack{
 		ItemType: protocol.ItemType{
 			NetworkID:     rid,
@@ -1036,7 +1060,7 @@ func StackFromItem(it item.Stack) protocol.ItemStack {
 		HasNetworkID:   true,
 		Count:          uint16(it.Count()),
 		BlockRuntimeID: int32(blockRuntimeID),
-		NBTData:        nbtconv.WriteItem(it, false),
+		NBTData:        nbtData,
 	}
 }
 
@@ -1055,7 +1079,11 @@ func StackToItem(it protocol.ItemStack) item.Stack {
 		t = nbter.DecodeNBT(it.NBTData).(world.Item)
 	}
 	s := item.NewStack(t, int(it.Count))
-	return nbtconv.Item(it.NBTData, &s)
+	s = nbtconv.Item(it.NBTData, &s)
+	if id, ok := it.NBTData[mapIDKey].(int64); ok {
+		s = s.WithValue(mapIDKey, id)
+	}
+	return s
 }
 
 // InstanceFromItem converts an item.Stack to its network ItemInstance representation.
@@ -0,0 +1,260 @@
+package bot
+
+import (
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/df-mc/dragonfly/server/block/cube"
+	"github.com/go-gl/mathgl/mgl32"
+	"github.com/sandertv/gophertunnel/minecraft"
+	"github.com/sandertv/gophertunnel/minecraft/protocol"
+	"github.com/sandertv/gophertunnel/minecraft/protocol/packet"
+)
+
+// Effect is a status effect active on the client.
+type Effect struct {
+	// Type is the ID of the effect, such as 1 for speed.
+	Type      int32
+	Amplifier int32
+	Particles bool
+	// Expires is the time the effect ends at, or the zero time if it lasts forever.
+	Expires time.Time
+}
+
+// SelfState is the state of the player of the client itself, as last sent by the server.
+type SelfState struct {
+	Health, MaxHealth float32
+	// HealthKnown is false until the server first sent the health of the player, until which Health is 0.
+	HealthKnown bool
+	// Food is the hunger bar of the player, from 0 to 20.
+	Food       float32
+	Saturation float32
+	XPLevel    int32
+	// XPProgress is the progress towards the next level, from 0 to 1.
+	XPProgress float32
+	// Attributes holds all attributes sent by the server, including those above.
+	Attributes Attributes
+	Effects    []Effect
+	GameType   int32
+	// MayFly is true if the player is allowed to fly, and Flying if it is flying.
+	MayFly, Flying bool
+	// SpawnPosition is the position the player respawns at, in the dimension SpawnDimension.
+	SpawnPosition  cube.Pos
+	SpawnDimension int
+	Dead           bool
+	// DeathPosition is the position the player last died at. DeathCause is the cause of death sent by the
+	// server while the player is dead, such as attack.player. It is empty if the server did not send it.
+	DeathPosition mgl32.Vec3
+	DeathCause    string
+}
+
+// selfState tracks the SelfState of a client.
+type selfState struct {
+	mu      sync.Mutex
+	s       SelfState
+	effects map[int32]Effect
+	// playerSpawn is true once the server set a spawn point specific to the player.
+	playerSpawn bool
+	// respawnReady is true if the server sent the position to respawn at, respawnPosition, since the player
+	// died.
+	respawnReady    bool
+	respawnPosition mgl32.Vec3
+}
+
+// reset resets the state to the one the client spawned with.
+func (s *selfState) reset(data minecraft.GameData) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.s = SelfState{
+		MaxHealth:      20,
+		Food:           20,
+		Saturation:     5,
+		GameType:       data.PlayerGameMode,
+		SpawnPosition:  blockPosFromProtocol(data.WorldSpawn),
+		SpawnDimension: int(data.Dimension),
+	}
+	s.effects = map[int32]Effect{}
+	s.playerSpawn, s.respawnReady = false, false
+}
+
+// State returns the health, food, experience, effects and other state of the player of the client.
+func (c *Client) State() SelfState {
+	c.selfState.mu.Lock()
+	defer c.selfState.mu.Unlock()
+	state := c.selfState.s
+	state.Attributes = slices.Clone(state.Attributes)
+	now := time.Now()
+	for _, e := range c.selfState.effects {
+		if e.Expires.IsZero() || e.Expires.After(now) {
+			state.Effects = append(state.Effects, e)
+		}
+	}
+	slices.SortFunc(state.Effects, func(a, b Effect) int {
+		return int(a.Type - b.Type)
+	})
+	return state
+}
+
+// setSelfAttributes applies attributes sent for the player of the client.
+func (c *Client) setSelfAttributes(attributes []protocol.Attribute) {
+	s := c.selfState
+	s.mu.Lock()
+	s.s.Attributes = s.s.Attributes.apply(attributes)
+	health, maxHealth := s.s.Attributes.Health()
+	if maxHealth != 0 {
+		s.s.MaxHealth = maxHealth
+	}
+	if v, ok := s.s.Attributes.Value("minecraft:player.hunger"); ok {
+		s.s.Food = v
+	}
+	if v, ok := s.s.Attributes.Value("minecraft:player.saturation"); ok {
+		s.s.Saturation = v
+	}
+	if v, ok := s.s.Attributes.Value("minecraft:player.level"); ok {
+		s.s.XPLevel = int32(v)
+	}
+	if v, ok := s.s.Attributes.Value("minecraft:player.experience"); ok {
+		s.s.XPProgress = v
+	}
+	s.mu.Unlock()
+
+	if slices.ContainsFunc(attributes, func(a protocol.Attribute) bool { return a.Name == "minecraft:health" }) {
+		c.setSelfHealth(health)
+	}
+}
+
+// setSelfHealth sets the health of the player of the client and publishes a DamagedEvent and DiedEvent if
+// the health dropped or reached 0. No DamagedEvent is published for the first health sent by the server.
+func (c *Client) setSelfHealth(health float32) {
+	s := c.selfState
+	s.mu.Lock()
+	previous, known, dead := s.s.Health, s.s.HealthKnown, s.s.Dead
+	s.s.Health, s.s.HealthKnown = health, true
+	respawned := dead && health > 0 && s.respawnReady
+	s.mu.Unlock()
+
+	switch {
+	case respawned:
+		c.selfRespawned()
+	case !dead:
+		if known && health < previous {
+			publishEvent(c, &DamagedEvent{Health: health, Previous: previous})
+		}
+		if health <= 0 {
+			c.selfDied()
+		}
+	}
+}
+
+// selfDied marks the player of the client as dead and publishes a DiedEvent, unless it was already dead.
+func (c *Client) selfDied() {
+	s := c.selfState
+	s.mu.Lock()
+	if s.s.Dead {
+		s.mu.Unlock()
+		return
+	}
+	s.s.Dead = true
+	s.s.Health = 0
+	s.s.DeathPosition = c.Self.Position
+	s.respawnReady = false
+	// Effects are cleared on death.
+	s.effects = map[int32]Effect{}
+	e := &DiedEvent{Position: s.s.DeathPosition}
+	s.mu.Unlock()
+	publishEvent(c, e)
+}
+
+// readyToSpawn handles a Respawn packet telling the client it may respawn at the position passed. Servers
+// send it either before or after resetting the health of the player, so the player respawned once both
+// happened.
+func (c *Client) readyToSpawn(pos mgl32.Vec3) {
+	s := c.selfState
+	s.mu.Lock()
+	if !s.s.Dead {
+		s.mu.Unlock()
+		return
+	}
+	s.respawnReady, s.respawnPosition = true, pos
+	alive := s.s.Health > 0
+	s.mu.Unlock()
+	if alive {
+		c.selfRespawned()
+	}
+}
+
+// selfRespawned marks the player of the client as alive and publishes a RespawnedEvent, unless it was
+// already alive.
+func (c *Client) selfRespawned() {
+	s := c.selfState
+	s.mu.Lock()
+	if !s.s.Dead {
+		s.mu.Unlock()
+		return
+	}
+	s.s.Dead, s.respawnReady = false, false
+	s.s.DeathCause = ""
+	e := &RespawnedEvent{Position: s.respawnPosition}
+	s.mu.Unlock()
+	publishEvent(c, e)
+}
+
+// setDeathCause sets the cause of the last death, as sent in a DeathInfo packet.
+func (s *selfState) setDeathCause(cause string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.s.DeathCause = cause
+}
+
+// applyEffect applies a MobEffect packet sent for the player of the client.
+func (s *selfState) applyEffect(p *packet.MobEffect) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if p.Operation == packet.MobEffectRemove {
+		delete(s.effects, p.EffectType)
+		return
+	}
+	e := Effect{Type: p.EffectType, Amplifier: p.Amplifier, Particles: p.Particles}
+	if p.Duration >= 0 {
+		e.Expires = time.Now().Add(time.Duration(p.Duration) * time.Second / 20)
+	}
+	s.effects[p.EffectType] = e
+}
+
+// applyAbilities applies the abilities of an UpdateAbilities packet sent for the player of the client.
+func (s *selfState) applyAbilities(data protocol.AbilityData) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, layer := range data.Layers {
+		if layer.Type != protocol.AbilityLayerTypeBase {
+			continue
+		}
+		if layer.Abilities&protocol.AbilityMayFly != 0 {
+			s.s.MayFly = layer.Values&protocol.AbilityMayFly != 0
+		}
+		if layer.Abilities&protocol.AbilityFlying != 0 {
+			s.s.Flying = layer.Values&protocol.AbilityFlying != 0
+		}
+	}
+}
+
+// setGameType sets the game type of the player of the client.
+func (s *selfState) setGameType(gameType int32) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.s.GameType = gameType
+}
+
+// setSpawn applies a SetSpawnPosition packet. The world spawn is only used until the server set a spawn
+// point for the player.
+func (s *selfState) setSpawn(p *packet.SetSpawnPosition) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if p.SpawnType == packet.SpawnTypeWorld && s.playerSpawn {
+		return
+	}
+	s.playerSpawn = s.playerSpawn || p.SpawnType == packet.SpawnTypePlayer
+	s.s.SpawnPosition = blockPosFromProtocol(p.Position)
+	s.s.SpawnDimension = int(p.Dimension)
+}
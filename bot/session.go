@@ -0,0 +1,331 @@
+package bot
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/df-mc/atomic"
+	"github.com/goxiaoy/go-eventbus"
+	"github.com/sandertv/gophertunnel/minecraft/protocol"
+	"github.com/sandertv/gophertunnel/minecraft/protocol/packet"
+)
+
+// readTimeout is the time without any packet from the server after which a session is considered dead.
+const readTimeout = 15 * time.Second
+
+// DisconnectCause describes why a game session ended.
+type DisconnectCause int
+
+const (
+	// CauseNetwork means the connection failed or was closed without a disconnect message.
+	CauseNetwork DisconnectCause = iota
+	// CauseKicked means the server closed the connection with a packet.Disconnect.
+	CauseKicked
+	// CauseTimeout means the server stopped sending packets for longer than the read timeout.
+	CauseTimeout
+	// CauseCancelled means the session was ended locally, either through the context passed or Disconnect.
+	CauseCancelled
+)
+
+// String ...
+func (c DisconnectCause) String() string {
+	switch c {
+	case CauseKicked:
+		return "kicked"
+	case CauseTimeout:
+		return "timeout"
+	case CauseCancelled:
+		return "cancelled"
+	default:
+		return "network"
+	}
+}
+
+// SessionError is returned by HandleGameContext once the session ends. Cause tells how it ended, Message
+// holds the kick message if the server disconnected the client.
+type SessionError struct {
+	Cause   DisconnectCause
+	Message string
+	Err     error
+}
+
+// Error ...
+func (e *SessionError) Error() string {
+	if e.Message != "" {
+		return fmt.Sprintf("session ended (%v): %v", e.Cause, e.Message)
+	}
+	return fmt.Sprintf("session ended (%v): %v", e.Cause, e.Err)
+}
+
+// Unwrap ...
+func (e *SessionError) Unwrap() error {
+	return e.Err
+}
+
+// session holds everything tied to a single connection: the context cancelled when it ends and the
+// goroutines that have to be stopped before HandleGameContext returns.
+type session struct {
+	ctx    context.Context
+	cancel context.CancelCauseFunc
+
+	mu     sync.Mutex
+	closed bool
+	wg     sync.WaitGroup
+
+	// kickMessage holds the message of the Disconnect packet sent by the server, or nil if none was
+	// received.
+	kickMessage atomic.Value[*string]
+	// startWeather holds the weather of the StartGame packet sent by the server, or nil if none was
+	// received.
+	startWeather atomic.Value[*weather]
+
+	// events holds the events waiting to be published by the dispatcher of the session, oldest first.
+	// queued is signalled when an event is added.
+	eventsMu sync.Mutex
+	events   []func(ctx context.Context)
+	queued   chan struct{}
+	// replay is true if the session replays a recording, in which case events are published right away.
+	replay bool
+
+	// writes holds the packets delayed by outbound handlers and the packets written after them, oldest
+	// first. writeQueued is signalled when a packet is added.
+	writesMu    sync.Mutex
+	writes      []queuedWrite
+	writeQueued chan struct{}
+}
+
+func newSession() *session {
+	ctx, cancel := context.WithCancelCause(context.Background())
+	return &session{ctx: ctx, cancel: cancel, queued: make(chan struct{}, 1), writeQueued: make(chan struct{}, 1)}
+}
+
+// Go runs f in a goroutine bound to the session. f must return once ctx is done. Calls after the session
+// ended are ignored.
+func (s *session) Go(f func(ctx context.Context)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed || s.ctx.Err() != nil {
+		return
+	}
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		f(s.ctx)
+	}()
+}
+
+// publish queues f to be run by the dispatcher of the session. Queued functions are run one by one, in the
+// order they were queued. Sessions replaying a recording run f right away instead.
+func (s *session) publish(f func(ctx context.Context)) {
+	if s.replay {
+		if s.ctx.Err() == nil {
+			f(s.ctx)
+		}
+		return
+	}
+	s.eventsMu.Lock()
+	s.events = append(s.events, f)
+	s.eventsMu.Unlock()
+	select {
+	case s.queued <- struct{}{}:
+	default:
+	}
+}
+
+// dispatch runs the functions queued with publish until the session ends. Functions still queued then are
+// dropped.
+func (s *session) dispatch(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-s.queued:
+		}
+		for ctx.Err() == nil {
+			s.eventsMu.Lock()
+			if len(s.events) == 0 {
+				s.eventsMu.Unlock()
+				break
+			}
+			f := s.events[0]
+			s.events[0] = nil
+			s.events = s.events[1:]
+			s.eventsMu.Unlock()
+			f(ctx)
+		}
+	}
+}
+
+// end ends the session with the error passed. Only the first call has any effect.
+func (s *session) end(err *SessionError) {
+	s.cancel(err)
+}
+
+// err returns the error the session ended with.
+func (s *session) err() *SessionError {
+	var sErr *SessionError
+	if errors.As(context.Cause(s.ctx), &sErr) {
+		return sErr
+	}
+	return &SessionError{Cause: CauseNetwork, Err: context.Cause(s.ctx)}
+}
+
+// wait blocks until all goroutines started with Go have returned.
+func (s *session) wait() {
+	s.mu.Lock()
+	s.closed = true
+	s.mu.Unlock()
+	s.wg.Wait()
+}
+
+// kicked records the message of a Disconnect packet sent by the server.
+func (s *session) kicked(message string) {
+	s.kickMessage.Store(&message)
+}
+
+// errorFromRead converts an error returned by ReadPacket to a SessionError. The session was only ended by
+// a kick if the server sent a Disconnect packet.
+func (s *session) errorFromRead(err error) *SessionError {
+	if message := s.kickMessage.Load(); message != nil {
+		return &SessionError{Cause: CauseKicked, Message: *message, Err: err}
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return &SessionError{Cause: CauseTimeout, Err: err}
+	}
+	return &SessionError{Cause: CauseNetwork, Err: err}
+}
+
+// recordPackets returns a function for minecraft.Dialer.PacketFunc that records packets sent by the server
+// that gophertunnel handles itself in the session passed: Disconnect packets, on which it closes the
+// connection without returning them from ReadPacket, and the weather of the StartGame packet, which is not
+// part of minecraft.GameData. remote returns the address of the server, or nil while still dialing.
+func recordPackets(s *session, remote func() net.Addr) func(header packet.Header, payload []byte, src, dst net.Addr) {
+	return func(header packet.Header, payload []byte, src, dst net.Addr) {
+		switch header.PacketID {
+		case packet.IDDisconnect:
+			// Packets written by the client are passed too, with the address of the server as dst.
+			if addr := remote(); addr == nil || src.String() != addr.String() {
+				return
+			}
+			pk := &packet.Disconnect{}
+			unmarshal(pk, payload)
+			s.kicked(pk.Message)
+		case packet.IDStartGame:
+			pk := &packet.StartGame{}
+			if unmarshal(pk, payload) {
+				s.startWeather.Store(&weather{rain: float64(pk.RainLevel), thunder: float64(pk.LightningLevel)})
+			}
+		}
+	}
+}
+
+// unmarshal decodes the payload passed into the packet passed and reports whether it was valid.
+func unmarshal(pk packet.Packet, payload []byte) (ok bool) {
+	defer func() {
+		if recover() != nil {
+			ok = false
+		}
+	}()
+	pk.Marshal(protocol.NewReader(bytes.NewBuffer(payload), 0, false))
+	return true
+}
+
+// Context returns the context of the current session. It is cancelled as soon as the session ends.
+func (c *Client) Context() context.Context {
+	if c.session == nil {
+		return context.Background()
+	}
+	return c.session.ctx
+}
+
+// Disconnect ends the current session, sending the message passed to the server before closing the
+// connection. HandleGameContext returns a SessionError with CauseCancelled afterwards.
+func (c *Client) Disconnect(message string) error {
+	if c.session == nil || c.conn == nil {
+		return nil
+	}
+	c.session.end(&SessionError{Cause: CauseCancelled, Message: message, Err: context.Canceled})
+	return c.closeConn(message)
+}
+
+// closeConn sends a disconnect to the server and closes the connection.
+func (c *Client) closeConn(message string) error {
+	_ = c.conn.WritePacket(&packet.Disconnect{
+		Reason:  packet.DisconnectReasonDisconnected,
+		Message: message,
+	})
+	err := c.conn.Close()
+	if errors.Is(err, net.ErrClosed) {
+		return nil
+	}
+	return err
+}
+
+// watchdog ends the session when nothing was read for longer than readTimeout.
+func (c *Client) watchdog(ctx context.Context, lastRead func() time.Time) {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if time.Since(lastRead()) > readTimeout {
+				c.Logger.Warnf("no packets received for %v, closing connection", readTimeout)
+				c.session.end(&SessionError{Cause: CauseTimeout, Err: context.DeadlineExceeded})
+				_ = c.conn.Close()
+				return
+			}
+		}
+	}
+}
+
+// publishEvent publishes the event passed on the EventBus of the client without blocking the caller.
+// Events of a session are published one by one, in the order publishEvent was called, and never outlive
+// HandleGameContext. Subscribers must not block waiting for later events, as those are only published
+// after they return. Subscribers are also called with the EventBus locked, so they must not subscribe to it
+// or dispose of a subscription themselves: that blocks the dispatcher and with it HandleGameContext for
+// good. ExpectEvent does not use the EventBus and may be used instead.
+func publishEvent[E any](c *Client, e E) {
+	if c.EventBus == nil {
+		return
+	}
+	if c.session == nil {
+		go publishNow(context.Background(), c, e)
+		return
+	}
+	c.session.publish(func(ctx context.Context) {
+		_ = publishNow(ctx, c, e)
+	})
+}
+
+// publishEvents publishes the events passed in order like publishEvent, but as a single task, so that large
+// batches of events do not queue a task each.
+func publishEvents[E any](c *Client, events []E) {
+	if c.EventBus == nil || len(events) == 0 {
+		return
+	}
+	publish := func(ctx context.Context) {
+		for _, e := range events {
+			_ = publishNow(ctx, c, e)
+		}
+	}
+	if c.session == nil {
+		go publish(context.Background())
+		return
+	}
+	c.session.publish(publish)
+}
+
+// publishNow publishes the event passed on the EventBus of the client and blocks until all subscribers
+// returned. The waits added with ExpectEvent are matched afterwards.
+func publishNow[E any](ctx context.Context, c *Client, e E) error {
+	err := eventbus.Publish[E](c.EventBus)(ctx, e)
+	c.eventWaiters.notify(e)
+	return err
+}
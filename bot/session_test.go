@@ -0,0 +1,37 @@
+package bot
+
+import (
+	"bytes"
+	"net"
+	"testing"
+
+	"github.com/sandertv/gophertunnel/minecraft/protocol"
+	"github.com/sandertv/gophertunnel/minecraft/protocol/packet"
+)
+
+func TestRecordPackets(t *testing.T) {
+	server := &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 19132}
+	client := &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 50000}
+	marshal := func(pk packet.Packet) []byte {
+		buf := bytes.NewBuffer(nil)
+		pk.Marshal(protocol.NewWriter(buf, 0))
+		return buf.Bytes()
+	}
+
+	s := newSession()
+	record := recordPackets(s, func() net.Addr { return server })
+	record(packet.Header{PacketID: packet.IDStartGame}, marshal(&packet.StartGame{RainLevel: 0.5, LightningLevel: 0.25}), server, client)
+	if w := s.startWeather.Load(); w == nil || *w != (weather{rain: 0.5, thunder: 0.25}) {
+		t.Errorf("start weather = %v, want rain 0.5 and thunder 0.25", w)
+	}
+
+	// Disconnect packets written by the client are not a kick.
+	record(packet.Header{PacketID: packet.IDDisconnect}, marshal(&packet.Disconnect{Message: "client"}), client, server)
+	if message := s.kickMessage.Load(); message != nil {
+		t.Fatalf("kick message = %q after a disconnect by the client, want none", *message)
+	}
+	record(packet.Header{PacketID: packet.IDDisconnect}, marshal(&packet.Disconnect{Message: "kicked"}), server, client)
+	if message := s.kickMessage.Load(); message == nil || *message != "kicked" {
+		t.Errorf("kick message = %v, want kicked", message)
+	}
+}
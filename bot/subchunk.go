@@ -0,0 +1,192 @@
+package bot
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/df-mc/dragonfly/server/block/cube"
+	"github.com/df-mc/dragonfly/server/world"
+	"github.com/df-mc/dragonfly/server/world/chunk"
+	"github.com/sandertv/gophertunnel/minecraft/nbt"
+	"github.com/sandertv/gophertunnel/minecraft/protocol"
+	"github.com/sandertv/gophertunnel/minecraft/protocol/packet"
+)
+
+// subChunkRequestMode checks if the LevelChunk passed holds no sub chunks, which must then be requested
+// with a SubChunkRequest.
+func subChunkRequestMode(p *packet.LevelChunk) bool {
+	return p.SubChunkCount == protocol.SubChunkRequestModeLimited || p.SubChunkCount == protocol.SubChunkRequestModeLimitless
+}
+
+// requestSubChunks stores the biomes and block entities of a LevelChunk sent in sub chunk request mode and
+// requests its sub chunks. Sub chunks already known for the column are kept until the responses arrive.
+func (e *EventsListener) requestSubChunks(c *Client, p *packet.LevelChunk) error {
+	r := e.dimensionRange(e.dimension())
+	if c.world == nil {
+		c.world = c.worldFor(e.dimension(), r)
+	}
+	ch := chunk.New(e.air, r)
+
+	b := bytes.NewBuffer(p.RawPayload)
+	if err := decodeBiomes(b, ch, chunk.NetworkEncoding); err != nil {
+		c.Logger.Warnf("Failed to decode biomes of chunk %v: %v", p.Position, err)
+	}
+	// Border blocks, which are not used.
+	_, _ = b.ReadByte()
+	bEnts := decodeBlockEntities(b)
+
+	count := len(ch.Sub())
+	if p.SubChunkCount == protocol.SubChunkRequestModeLimited {
+		count = min(int(p.HighestSubChunk)+1, count)
+	}
+	// Sub chunks above the highest one requested are air, all others are pending until received.
+	pending := make([]bool, len(ch.Sub()))
+	for i := 0; i < count; i++ {
+		pending[i] = true
+	}
+
+	pos := world.ChunkPos(p.Position)
+	if column := c.world.loadedChunk(pos); column != nil {
+		column.Lock()
+		copy(ch.Sub(), column.Sub())
+		for i := range pending {
+			// Sub chunks already received are kept until replaced, so that changes are found.
+			pending[i] = pending[i] && column.subPending(i)
+		}
+		for bPos, data := range column.BlockEntities {
+			if _, ok := bEnts[bPos]; !ok {
+				bEnts[bPos] = data
+			}
+		}
+		column.Unlock()
+	}
+	column := c.world.setChunk(pos, ch, bEnts)
+	column.Lock()
+	column.pending = pending
+	column.Unlock()
+	publishEvent(c, &ChunkLoadedEvent{Position: pos, Dimension: e.dimension()})
+	e.evictChunks(c)
+
+	offsets := make([]protocol.SubChunkOffset, 0, count)
+	for i := 0; i < count; i++ {
+		offsets = append(offsets, protocol.SubChunkOffset{0, int8(i), 0})
+	}
+	return c.WritePacket(&packet.SubChunkRequest{
+		Dimension: p.Dimension,
+		Position:  protocol.SubChunkPos{p.Position.X(), int32(r.Min() >> 4), p.Position.Z()},
+		Offsets:   offsets,
+	})
+}
+
+// readSubChunks decodes the sub chunks of a SubChunk response into the World.
+func (e *EventsListener) readSubChunks(c *Client, p *packet.SubChunk) error {
+	if p.CacheEnabled {
+		return e.cachedSubChunks(c, p)
+	}
+	if int(p.Dimension) != e.dimension() {
+		return nil
+	}
+	r := e.dimensionRange(e.dimension())
+	if c.world == nil {
+		c.world = c.worldFor(e.dimension(), r)
+	}
+	for _, entry := range p.SubChunkEntries {
+		if err := e.readSubChunk(c, r, p.Position, entry); err != nil {
+			c.Logger.Warnf("Failed to decode sub chunk: %v", err)
+		}
+	}
+	return nil
+}
+
+// readSubChunk decodes a single sub chunk entry relative to the center passed into the World.
+func (e *EventsListener) readSubChunk(c *Client, r cube.Range, center protocol.SubChunkPos, entry protocol.SubChunkEntry) error {
+	pos := world.ChunkPos{center.X() + int32(entry.Offset[0]), center.Z() + int32(entry.Offset[2])}
+	subY := int(center.Y()) + int(entry.Offset[1])
+	index := subY - r.Min()>>4
+	if index < 0 || index >= (r.Height()>>4)+1 {
+		return fmt.Errorf("sub chunk %v at %v out of range %v", subY, pos, r)
+	}
+
+	var (
+		sub   *chunk.SubChunk
+		bEnts map[cube.Pos]map[string]any
+	)
+	switch entry.Result {
+	case protocol.SubChunkResultSuccess:
+		if len(entry.RawPayload) == 0 {
+			return fmt.Errorf("sub chunk %v at %v has no payload", subY, pos)
+		}
+		b := bytes.NewBuffer(entry.RawPayload)
+		i := uint8(index)
+		var err error
+		if sub, err = decodeSubChunk(b, chunk.New(e.air, r), &i, chunk.NetworkEncoding); err != nil {
+			return err
+		}
+		bEnts = decodeBlockEntities(b)
+	case protocol.SubChunkResultSuccessAllAir:
+		sub = chunk.NewSubChunk(e.air)
+	default:
+		return nil
+	}
+
+	column := c.world.loadedChunk(pos)
+	if column == nil {
+		column = c.world.setChunk(pos, chunk.New(e.air, r), map[cube.Pos]map[string]any{})
+		column.Lock()
+		column.pending = make([]bool, len(column.Sub()))
+		for i := range column.pending {
+			column.pending[i] = true
+		}
+		column.Unlock()
+		e.evictChunks(c)
+	}
+	// Deferred first, so that it runs after the column is unlocked.
+	defer c.world.invalidateLight(pos)
+	column.Lock()
+	defer column.Unlock()
+	if !column.subPending(index) {
+		c.diffSubChunks(pos, subY, column.Sub()[index], sub)
+	} else {
+		column.pending[index] = false
+	}
+	column.Sub()[index] = sub
+	column.size.Store(columnSize(column.Chunk))
+	for bPos, data := range bEnts {
+		column.BlockEntities[bPos] = data
+	}
+	column.applyHeightMap(int16(subY<<4), entry.HeightMapType, entry.HeightMapData)
+	column.dirty = true
+	return nil
+}
+
+// updateSubChunkBlocks applies the block changes of an UpdateSubChunkBlocks packet to the World. A
+// BrokeBlockEvent is only published for blocks of loaded columns that were not air before.
+func (e *EventsListener) updateSubChunkBlocks(c *Client, p *packet.UpdateSubChunkBlocks) {
+	for _, entry := range p.Blocks {
+		if c.changeBlock(blockPosFromProtocol(entry.BlockPos), 0, entry.BlockRuntimeID, entry.Flags, BlockChangeSubChunkBatch) {
+			publishEvent(c, &BrokeBlockEvent{Position: entry.BlockPos})
+		}
+	}
+	for _, entry := range p.Extra {
+		c.changeBlock(blockPosFromProtocol(entry.BlockPos), 1, entry.BlockRuntimeID, entry.Flags, BlockChangeSubChunkBatch)
+	}
+}
+
+// decodeBlockEntities decodes the network NBT encoded block entities left in the buffer passed.
+func decodeBlockEntities(b *bytes.Buffer) map[cube.Pos]map[string]any {
+	bEnts := map[cube.Pos]map[string]any{}
+	dec := nbt.NewDecoderWithEncoding(b, nbt.NetworkLittleEndian)
+	for b.Len() > 0 {
+		var bNBT map[string]any
+		if err := dec.Decode(&bNBT); err != nil {
+			break
+		}
+		x, okX := bNBT["x"].(int32)
+		y, okY := bNBT["y"].(int32)
+		z, okZ := bNBT["z"].(int32)
+		if okX && okY && okZ {
+			bEnts[cube.Pos{int(x), int(y), int(z)}] = bNBT
+		}
+	}
+	return bEnts
+}
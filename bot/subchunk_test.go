@@ -0,0 +1,82 @@
+package bot
+
+import (
+	"testing"
+
+	"github.com/df-mc/dragonfly/server/world"
+	"github.com/sandertv/gophertunnel/minecraft/protocol"
+)
+
+// testHeightMap returns height map data of a sub chunk with every entry set to the default passed, except
+// the one at the x and z passed.
+func testHeightMap(def, x, z, h int8) []int8 {
+	data := make([]int8, 256)
+	for i := range data {
+		data[i] = def
+	}
+	data[int(z)<<4|int(x)] = h
+	return data
+}
+
+func TestReadSubChunkHeightMap(t *testing.T) {
+	r := world.Overworld.Range()
+	tests := []struct {
+		name    string
+		subY    int8
+		mapType byte
+		data    []int8
+		// want is the height expected at 1, 2, other is the height expected everywhere else.
+		want, other int16
+		noHeightMap bool
+	}{
+		{name: "lowest sub chunk", subY: -4, mapType: protocol.HeightMapDataHasData, data: testHeightMap(-1, 1, 2, 5), want: -59, other: -64},
+		{name: "above zero", subY: 2, mapType: protocol.HeightMapDataHasData, data: testHeightMap(-1, 1, 2, 3), want: 35, other: -64},
+		{name: "heights in other sub chunks", subY: 0, mapType: protocol.HeightMapDataHasData, data: testHeightMap(16, 1, 2, -1), want: -64, other: -64},
+		{name: "no data", subY: 0, mapType: protocol.HeightMapDataTooHigh, noHeightMap: true},
+		{name: "wrong length", subY: 0, mapType: protocol.HeightMapDataHasData, data: make([]int8, 16), noHeightMap: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := NewClient()
+			c.world = NewWorld(r)
+			e := &EventsListener{air: air}
+			// The column is not loaded yet, so that all of its sub chunks are pending.
+			err := e.readSubChunk(c, r, protocol.SubChunkPos{}, protocol.SubChunkEntry{
+				Offset:        protocol.SubChunkOffset{0, tt.subY, 0},
+				Result:        protocol.SubChunkResultSuccessAllAir,
+				HeightMapType: tt.mapType,
+				HeightMapData: tt.data,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			col := c.world.Chunk(world.ChunkPos{})
+			if col == nil {
+				t.Fatal("column not loaded")
+			}
+			index := int(tt.subY) - r.Min()>>4
+			for i := range col.Sub() {
+				if pending := col.subPending(i); pending != (i != index) {
+					t.Errorf("sub chunk %v pending: %v, want %v", i, pending, i != index)
+				}
+			}
+			if tt.noHeightMap {
+				if col.heightMap != nil {
+					t.Error("height map applied, want none")
+				}
+				return
+			}
+			for x := uint8(0); x < 16; x++ {
+				for z := uint8(0); z < 16; z++ {
+					want := tt.other
+					if x == 1 && z == 2 {
+						want = tt.want
+					}
+					if h := col.Height(x, z); h != want {
+						t.Errorf("Height(%v, %v) = %v, want %v", x, z, h, want)
+					}
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,181 @@
+package bot
+
+import (
+	"context"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/df-mc/atomic"
+	"github.com/go-gl/mathgl/mgl32"
+	"github.com/sandertv/gophertunnel/minecraft/protocol"
+	"github.com/sandertv/gophertunnel/minecraft/protocol/packet"
+)
+
+// tickDuration is the duration of a single game tick at 20 TPS.
+const tickDuration = time.Second / 20
+
+// tickTask is a function scheduled to run after a number of ticks.
+type tickTask struct {
+	remaining uint64
+	f         func(*Client)
+}
+
+// scheduler is the game clock of a Client. It counts ticks and runs tasks scheduled ahead.
+type scheduler struct {
+	tick atomic.Uint64
+
+	mu    sync.Mutex
+	tasks []*tickTask
+	// input is the input queued for the PlayerAuthInput of the next tick, or nil if nothing was queued.
+	input *queuedInput
+
+	// lastInput is the position sent in the last PlayerAuthInput. Only doTick accesses it.
+	lastInput mgl32.Vec3
+}
+
+// queuedInput is input queued to be sent with the PlayerAuthInput of the next tick.
+type queuedInput struct {
+	// position is sent instead of the position of the player if not nil.
+	position *mgl32.Vec3
+	flags    []int
+}
+
+// Tick returns the current tick of the session, as sent in PlayerAuthInput. It is reset to 0 on every
+// new connection.
+func (c *Client) Tick() uint64 {
+	return c.clock.tick.Load()
+}
+
+// Schedule runs f on the tick loop after the amount of ticks passed. A delay of 0 runs f on the next tick.
+func (c *Client) Schedule(ticks uint64, f func(*Client)) {
+	c.clock.mu.Lock()
+	defer c.clock.mu.Unlock()
+	c.clock.tasks = append(c.clock.tasks, &tickTask{remaining: ticks, f: f})
+}
+
+// After returns a channel that is closed once the amount of ticks passed elapsed. Like Schedule, a delay
+// of 0 means the next tick.
+func (c *Client) After(ticks uint64) <-chan struct{} {
+	done := make(chan struct{})
+	c.Schedule(ticks, func(*Client) { close(done) })
+	return done
+}
+
+// WaitTicks blocks until the amount of ticks passed elapsed or ctx is done.
+func (c *Client) WaitTicks(ctx context.Context, ticks uint64) error {
+	select {
+	case <-c.After(ticks):
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// tickLoop runs a tick every 50 milliseconds until ctx is done.
+func (c *Client) tickLoop(ctx context.Context) {
+	t := time.NewTicker(tickDuration)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+			c.doTick()
+		}
+	}
+}
+
+// doTick runs the TickHandlers by priority, sends the PlayerAuthInput of the tick to the server and then
+// runs the tasks that are due, so that tasks waiting for a tick observe the input of that tick as sent.
+func (c *Client) doTick() {
+	c.clock.tick.Inc()
+
+	c.Events.hLock.Lock()
+	tickers := slices.Clone(c.Events.tickers)
+	c.Events.hLock.Unlock()
+	for _, h := range tickers {
+		if err := h.F(c); err != nil {
+			c.Logger.Warnf("tick handler: %v", err)
+		}
+	}
+
+	if c.Self != nil {
+		c.WritePacket(c.nextInput())
+	}
+
+	c.clock.mu.Lock()
+	var due []*tickTask
+	c.clock.tasks = slices.DeleteFunc(c.clock.tasks, func(t *tickTask) bool {
+		if t.remaining == 0 {
+			due = append(due, t)
+			return true
+		}
+		t.remaining--
+		return false
+	})
+	c.clock.mu.Unlock()
+	for _, t := range due {
+		t.f(c)
+	}
+}
+
+// queueInput queues the position, if not nil, and input flags passed to be sent with the PlayerAuthInput
+// of the next tick. Flags queued more than once in a tick are combined, and the last position queued wins.
+func (c *Client) queueInput(position *mgl32.Vec3, flags ...int) {
+	c.clock.mu.Lock()
+	defer c.clock.mu.Unlock()
+	if c.clock.input == nil {
+		c.clock.input = &queuedInput{}
+	}
+	if position != nil {
+		c.clock.input.position = position
+	}
+	c.clock.input.flags = append(c.clock.input.flags, flags...)
+}
+
+// nextInput returns the PlayerAuthInput of the current tick, holding the input queued since the last tick.
+func (c *Client) nextInput() *packet.PlayerAuthInput {
+	c.clock.mu.Lock()
+	input := c.clock.input
+	c.clock.input = nil
+	c.clock.mu.Unlock()
+
+	position := c.Self.Position
+	if input == nil {
+		return c.authInput(position)
+	}
+	if input.position != nil {
+		position = *input.position
+	}
+	return c.authInput(position, input.flags...)
+}
+
+// authInput returns a PlayerAuthInput for the current tick with the position and input flags passed. It
+// must only be called by doTick.
+func (c *Client) authInput(position mgl32.Vec3, flags ...int) *packet.PlayerAuthInput {
+	inputData := protocol.NewBitset(packet.PlayerAuthInputBitsetSize)
+	for _, flag := range flags {
+		inputData.Set(flag)
+	}
+	inputMode := uint32(c.conn.ClientData().CurrentInputMode)
+	interactionModel := uint32(packet.InteractionModelCrosshair)
+	if inputMode == packet.InputModeTouch {
+		interactionModel = packet.InteractionModelTouch
+	}
+	delta := position.Sub(c.clock.lastInput)
+	c.clock.lastInput = position
+
+	return &packet.PlayerAuthInput{
+		InputData:        inputData,
+		Position:         position,
+		Pitch:            c.Self.Pitch,
+		Yaw:              c.Self.Yaw,
+		HeadYaw:          c.Self.HeadYaw,
+		InputMode:        inputMode,
+		PlayMode:         packet.PlayModeNormal,
+		InteractionModel: interactionModel,
+		Tick:             c.Tick(),
+		Delta:            delta,
+	}
+}
@@ -0,0 +1,236 @@
+package bot
+
+import (
+	"cmp"
+	"slices"
+
+	"github.com/df-mc/dragonfly/server/world"
+	"github.com/df-mc/dragonfly/server/world/chunk"
+	"golang.org/x/exp/maps"
+)
+
+// viewMargin is the number of chunks beyond the radius of a chunk view that columns are kept for, so that
+// columns on the edge of the view are not evicted and sent again while moving back and forth.
+const viewMargin = 1
+
+// viewlessLimit is the approximate number of bytes the columns of a World no client uses any longer may
+// use, for example after all clients left its dimension. The least recently used columns are evicted
+// beyond it, unless the memory limit of the World is lower.
+const viewlessLimit = 16 << 20
+
+// chunkView is the area around a center in which the server sends chunks to a client.
+type chunkView struct {
+	center world.ChunkPos
+	// radius is the radius of the view in chunks.
+	radius int32
+}
+
+// contains checks if the column at the position passed is within the view, including the viewMargin.
+func (v chunkView) contains(pos world.ChunkPos) bool {
+	x, z, r := int64(pos[0]-v.center[0]), int64(pos[1]-v.center[1]), int64(v.radius+viewMargin)
+	return x*x+z*z <= r*r
+}
+
+// WorldStats holds statistics of the columns of a World.
+type WorldStats struct {
+	// Chunks is the number of columns loaded.
+	Chunks int
+	// Bytes is the approximate number of bytes used by the blocks of the columns loaded.
+	Bytes int64
+	// Evicted is the number of columns evicted since the World was created.
+	Evicted uint64
+}
+
+// Stats returns statistics of the columns of the World.
+func (w *World) Stats() WorldStats {
+	if w == nil {
+		return WorldStats{}
+	}
+	w.chunkMutex.Lock()
+	defer w.chunkMutex.Unlock()
+	stats := WorldStats{Chunks: len(w.chunks), Evicted: w.evicted}
+	for _, c := range w.chunks {
+		stats.Bytes += c.size.Load()
+	}
+	return stats
+}
+
+// SetMemoryLimit sets the approximate number of bytes the columns of the World may use. Once exceeded,
+// the least recently used columns are evicted, even if they are within the view of a client. A limit of 0
+// disables the limit.
+func (w *World) SetMemoryLimit(bytes int64) {
+	w.chunkMutex.Lock()
+	defer w.chunkMutex.Unlock()
+	w.limit = bytes
+}
+
+// setView sets the chunk view of the client passed.
+func (w *World) setView(c *Client, v chunkView) {
+	w.chunkMutex.Lock()
+	defer w.chunkMutex.Unlock()
+	w.views[c] = v
+	w.viewed = true
+}
+
+// removeView removes the chunk view of the client passed, which no longer uses the World. Columns are not
+// evicted until the next call to evict.
+func (w *World) removeView(c *Client) {
+	if w == nil {
+		return
+	}
+	w.chunkMutex.Lock()
+	defer w.chunkMutex.Unlock()
+	delete(w.views, c)
+}
+
+// evict removes all columns outside the views of the clients using the World, and the least recently used
+// columns while the memory limit, or the viewlessLimit if no client uses the World any longer, is exceeded.
+// The columns removed are returned.
+func (w *World) evict() map[world.ChunkPos]*Column {
+	w.chunkMutex.Lock()
+	defer w.chunkMutex.Unlock()
+
+	evicted := map[world.ChunkPos]*Column{}
+	if len(w.views) > 0 {
+		for pos, c := range w.chunks {
+			if !w.inView(pos) {
+				evicted[pos] = c
+				delete(w.chunks, pos)
+			}
+		}
+	}
+	limit := w.limit
+	if len(w.views) == 0 && w.viewed && (limit == 0 || limit > viewlessLimit) {
+		limit = viewlessLimit
+	}
+	if limit > 0 {
+		var total int64
+		for _, c := range w.chunks {
+			total += c.size.Load()
+		}
+		if total > limit {
+			positions := maps.Keys(w.chunks)
+			slices.SortFunc(positions, func(a, b world.ChunkPos) int {
+				return cmp.Compare(w.chunks[a].lastUsed, w.chunks[b].lastUsed)
+			})
+			for _, pos := range positions {
+				if total <= limit {
+					break
+				}
+				c := w.chunks[pos]
+				total -= c.size.Load()
+				evicted[pos] = c
+				delete(w.chunks, pos)
+			}
+		}
+	}
+	w.evicted += uint64(len(evicted))
+	return evicted
+}
+
+// inView checks if the column at the position passed is within the view of any client. The chunk mutex
+// must be held.
+func (w *World) inView(pos world.ChunkPos) bool {
+	for _, v := range w.views {
+		if v.contains(pos) {
+			return true
+		}
+	}
+	return false
+}
+
+// evictChunks updates the chunk view of the client in its World and schedules the columns no longer
+// needed to be evicted on the next tick, so that a burst of chunks is only scanned once.
+func (e *EventsListener) evictChunks(c *Client) {
+	w := c.world
+	if w == nil {
+		return
+	}
+	if e.view != nil {
+		v := *e.view
+		if v.radius == 0 {
+			v.radius = e.chunkRadius
+		}
+		if v.radius > 0 {
+			w.setView(c, v)
+		}
+	}
+	e.evictWorld.Store(w)
+}
+
+// evictScheduled evicts the columns of the World passed to evictChunks since the last tick, if any. It is
+// called every tick.
+func (e *EventsListener) evictScheduled(c *Client) error {
+	if w := e.evictWorld.Swap(nil); w != nil {
+		e.evict(c, w)
+	}
+	return nil
+}
+
+// evict evicts the columns of the World passed no longer needed. Changed columns evicted are written to
+// the Mirror of the client, if any.
+func (e *EventsListener) evict(c *Client, w *World) {
+	evicted := w.evict()
+	if len(evicted) == 0 {
+		return
+	}
+	if c.mirror != nil {
+		if err := c.mirror.storeColumns(w.dimension, evicted, false); err != nil {
+			c.Logger.Warnf("Failed to save evicted chunks: %v", err)
+		}
+	}
+	for pos := range evicted {
+		publishEvent(c, &ChunkUnloadedEvent{Position: pos, Dimension: w.dimension})
+	}
+}
+
+// columnSize returns the approximate number of bytes used by the blocks of the chunk passed.
+func columnSize(c *chunk.Chunk) int64 {
+	var size int64
+	for _, sub := range c.Sub() {
+		size += subChunkSize(sub)
+	}
+	return size
+}
+
+// subChunkSize returns the approximate number of bytes used by the blocks of the sub chunk passed.
+func subChunkSize(sub *chunk.SubChunk) int64 {
+	var size int64
+	for _, storage := range sub.Layers() {
+		size += storageSize(storage)
+	}
+	return size
+}
+
+// storageSize returns the approximate number of bytes used by the paletted storage passed: the block
+// indices, packed into uint32s, and the palette.
+func storageSize(s *chunk.PalettedStorage) int64 {
+	n := s.Palette().Len()
+	var bits int64
+	switch {
+	case n <= 1:
+		bits = 0
+	case n <= 2:
+		bits = 1
+	case n <= 4:
+		bits = 2
+	case n <= 8:
+		bits = 3
+	case n <= 16:
+		bits = 4
+	case n <= 32:
+		bits = 5
+	case n <= 64:
+		bits = 6
+	case n <= 256:
+		bits = 8
+	default:
+		bits = 16
+	}
+	var indices int64
+	if bits > 0 {
+		perWord := 32 / bits
+		indices = (4096 + perWord - 1) / perWord * 4
+	}
+	return indices + int64(n)*4
+}
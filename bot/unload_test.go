@@ -0,0 +1,182 @@
+package bot
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/df-mc/dragonfly/server/block"
+	"github.com/df-mc/dragonfly/server/world"
+	"github.com/df-mc/dragonfly/server/world/chunk"
+	"golang.org/x/exp/maps"
+)
+
+// testColumns adds an empty column of the size passed to the World passed at every position passed, in
+// order, so that the first position is the least recently used.
+func testColumns(w *World, size int64, positions ...world.ChunkPos) {
+	for _, pos := range positions {
+		col := w.setChunk(pos, chunk.New(air, w.Range()), nil)
+		col.size.Store(size)
+	}
+}
+
+// sortedPositions returns the positions of the columns passed, sorted.
+func sortedPositions(columns map[world.ChunkPos]*Column) []world.ChunkPos {
+	positions := maps.Keys(columns)
+	slices.SortFunc(positions, func(a, b world.ChunkPos) int {
+		if a[0] != b[0] {
+			return int(a[0] - b[0])
+		}
+		return int(a[1] - b[1])
+	})
+	return positions
+}
+
+func TestEvictView(t *testing.T) {
+	tests := []struct {
+		name      string
+		views     []chunkView
+		positions []world.ChunkPos
+		want      []world.ChunkPos
+	}{
+		{
+			name:      "within radius",
+			views:     []chunkView{{radius: 2}},
+			positions: []world.ChunkPos{{0, 0}, {2, 0}, {0, -2}, {1, 1}},
+		},
+		{
+			name:      "within margin",
+			views:     []chunkView{{radius: 2}},
+			positions: []world.ChunkPos{{3, 0}, {-3, 0}, {2, 2}},
+		},
+		{
+			name:      "beyond margin",
+			views:     []chunkView{{radius: 2}},
+			positions: []world.ChunkPos{{0, 0}, {4, 0}, {3, 2}, {0, -4}},
+			want:      []world.ChunkPos{{0, -4}, {3, 2}, {4, 0}},
+		},
+		{
+			name:      "moved center",
+			views:     []chunkView{{center: world.ChunkPos{-10, 10}, radius: 2}},
+			positions: []world.ChunkPos{{0, 0}, {-10, 10}, {-13, 10}, {-14, 10}},
+			want:      []world.ChunkPos{{-14, 10}, {0, 0}},
+		},
+		{
+			name:      "any view",
+			views:     []chunkView{{radius: 1}, {center: world.ChunkPos{8, 0}, radius: 1}},
+			positions: []world.ChunkPos{{0, 0}, {2, 0}, {4, 0}, {6, 0}, {8, 0}},
+			want:      []world.ChunkPos{{4, 0}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := NewWorld(world.Overworld.Range())
+			testColumns(w, 1, tt.positions...)
+			for _, v := range tt.views {
+				w.setView(&Client{}, v)
+			}
+			if evicted := sortedPositions(w.evict()); !slices.Equal(evicted, tt.want) {
+				t.Errorf("evicted %v, want %v", evicted, tt.want)
+			}
+			if n := w.Stats().Chunks; n != len(tt.positions)-len(tt.want) {
+				t.Errorf("%v columns left, want %v", n, len(tt.positions)-len(tt.want))
+			}
+		})
+	}
+}
+
+func TestEvictLimit(t *testing.T) {
+	positions := []world.ChunkPos{{0, 0}, {1, 0}, {2, 0}, {3, 0}}
+	tests := []struct {
+		name  string
+		limit int64
+		// used holds the positions of the columns used after all were added, in order.
+		used []world.ChunkPos
+		want []world.ChunkPos
+	}{
+		{name: "no limit"},
+		{name: "below limit", limit: 500},
+		{name: "at limit", limit: 400},
+		{name: "least recently added", limit: 250, want: []world.ChunkPos{{0, 0}, {1, 0}}},
+		{
+			name:  "least recently used",
+			limit: 250,
+			used:  []world.ChunkPos{{1, 0}, {0, 0}},
+			want:  []world.ChunkPos{{2, 0}, {3, 0}},
+		},
+		{name: "below all", limit: 50, want: positions},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := NewWorld(world.Overworld.Range())
+			testColumns(w, 100, positions...)
+			for _, pos := range tt.used {
+				w.Chunk(pos)
+			}
+			// The limit applies to columns within the view of a client too.
+			w.setView(&Client{}, chunkView{radius: 8})
+			w.SetMemoryLimit(tt.limit)
+			if evicted := sortedPositions(w.evict()); !slices.Equal(evicted, tt.want) {
+				t.Errorf("evicted %v, want %v", evicted, tt.want)
+			}
+			if stats := w.Stats(); stats.Evicted != uint64(len(tt.want)) {
+				t.Errorf("Stats().Evicted = %v, want %v", stats.Evicted, len(tt.want))
+			}
+		})
+	}
+}
+
+func TestColumnSize(t *testing.T) {
+	r := world.Overworld.Range()
+	stone := world.BlockRuntimeID(block.Stone{})
+	tests := []struct {
+		name   string
+		blocks []uint32
+		want   int64
+	}{
+		// Empty sub chunks hold no layers.
+		{name: "empty"},
+		// A palette of 2 needs 1 bit per block: 128 words of indices.
+		{name: "one block", blocks: []uint32{stone}, want: 128*4 + 2*4},
+		// A palette of 3 needs 2 bits per block: 256 words of indices.
+		{name: "two blocks", blocks: []uint32{stone, world.BlockRuntimeID(block.Dirt{})}, want: 256*4 + 3*4},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := chunk.New(air, r)
+			for i, rid := range tt.blocks {
+				c.SetBlock(uint8(i), 0, 0, 0, rid)
+			}
+			if size := columnSize(c); size != tt.want {
+				t.Errorf("columnSize() = %v, want %v", size, tt.want)
+			}
+		})
+	}
+}
+
+func TestEvictViewless(t *testing.T) {
+	c := &Client{}
+	positions := []world.ChunkPos{{0, 0}, {1, 0}, {2, 0}}
+
+	w := NewWorld(world.Overworld.Range())
+	testColumns(w, viewlessLimit/2, positions...)
+	if evicted := w.evict(); len(evicted) != 0 {
+		t.Fatalf("evicted %v from a World never viewed, want none", sortedPositions(evicted))
+	}
+
+	w.setView(c, chunkView{center: world.ChunkPos{1, 0}, radius: 4})
+	if evicted := w.evict(); len(evicted) != 0 {
+		t.Fatalf("evicted %v within the view, want none", sortedPositions(evicted))
+	}
+	// Use the first column, so that the second is the least recently used.
+	w.Chunk(positions[0])
+	w.removeView(c)
+	if evicted := sortedPositions(w.evict()); !slices.Equal(evicted, []world.ChunkPos{{1, 0}}) {
+		t.Errorf("evicted %v once left, want [(1, 0)]", evicted)
+	}
+
+	// A lower memory limit of the World is kept. The first column was used after the last one was added.
+	w.SetMemoryLimit(viewlessLimit / 2)
+	if evicted := sortedPositions(w.evict()); !slices.Equal(evicted, []world.ChunkPos{{2, 0}}) {
+		t.Errorf("evicted %v with a lower limit, want [(2, 0)]", evicted)
+	}
+}
@@ -1,6 +1,7 @@
 package bot
 
 import (
+	"github.com/df-mc/atomic"
 	"github.com/df-mc/dragonfly/server/block/cube"
 	"github.com/df-mc/dragonfly/server/world"
 	_ "github.com/df-mc/dragonfly/server/world"
@@ -18,7 +19,29 @@ import (
 type World struct {
 	chunks     map[world.ChunkPos]*Column
 	r          cube.Range
+	dimension  int
 	chunkMutex sync.Mutex
+	// lightMu is held while calculating light, which locks multiple columns at once.
+	lightMu sync.Mutex
+
+	// views holds the chunk view of every client using the World. Once any view is known, columns
+	// outside all views are evicted.
+	views map[*Client]chunkView
+	// viewed is true once any client had a view of the World. Without views after that, no client uses
+	// the World any longer.
+	viewed bool
+	// limit is the approximate number of bytes the columns may use before the least recently used are
+	// evicted, or 0 for no limit.
+	limit int64
+	// clock is incremented every time a column is used, to find the least recently used columns.
+	clock   uint64
+	evicted uint64
+
+	// load, if not nil, is called with the position of a column missing from the World to load it in the
+	// background, after which finishLoad must be called. loading holds the positions of columns being
+	// loaded, which are not loaded again until then.
+	load    func(pos world.ChunkPos)
+	loading map[world.ChunkPos]struct{}
 }
 
 func NewWorld(r cube.Range) *World {
@@ -27,27 +50,69 @@ func NewWorld(r cube.Range) *World {
 		chunks:     map[world.ChunkPos]*Column{},
 		r:          r,
 		chunkMutex: sync.Mutex{},
+		views:      map[*Client]chunkView{},
+		loading:    map[world.ChunkPos]struct{}{},
 	}
 }
 
 var air, _ = chunk.StateToRuntimeID("minecraft:air", nil)
 var airB, _ = world.BlockByRuntimeID(air)
 
-// Block reads a block from the position passed. If a chunk is not yet loaded at that position, the chunk is
-// loaded, or generated if it could not be found in the world save, and the block returned. Chunks will be
-// loaded synchronously.
+// Chunk returns the column at the position passed, or nil if it is not loaded. Worlds mirrored to a world
+// save start loading missing columns from it in the background, so that later calls may return them.
 func (w *World) Chunk(pos world.ChunkPos) *Column {
+	return w.chunk(pos, true)
+}
+
+// loadedChunk returns the column at the position passed like Chunk, but does not load it from a world save
+// if it is missing. It is used for columns the server sends anyway and for the neighbours of columns, which
+// would otherwise load each other in turn.
+func (w *World) loadedChunk(pos world.ChunkPos) *Column {
+	return w.chunk(pos, false)
+}
+
+// chunk returns the column at the position passed, starting to load it if it is missing and load is true.
+func (w *World) chunk(pos world.ChunkPos, load bool) *Column {
 	w.chunkMutex.Lock()
 	defer w.chunkMutex.Unlock()
 	if c, ok := w.chunks[pos]; ok {
+		w.clock++
+		c.lastUsed = w.clock
 		return c
 	}
+	if _, ok := w.loading[pos]; load && w.load != nil && !ok {
+		w.loading[pos] = struct{}{}
+		w.load(pos)
+	}
 	return nil
 }
-func (w *World) setChunk(pos world.ChunkPos, c *chunk.Chunk, b map[cube.Pos]map[string]any) {
+
+// finishLoad adds the column passed, loaded after a call to load, unless a column was set at its position in
+// the meantime. col is nil if the column could not be loaded.
+func (w *World) finishLoad(pos world.ChunkPos, col *chunk.Column) {
 	w.chunkMutex.Lock()
-	defer w.chunkMutex.Unlock()
-	w.chunks[pos] = newColumn(c, b)
+	delete(w.loading, pos)
+	_, ok := w.chunks[pos]
+	if col == nil || ok {
+		w.chunkMutex.Unlock()
+		return
+	}
+	w.chunks[pos] = newColumn(col.Chunk, blockEntityMap(col.BlockEntities))
+	w.clock++
+	w.chunks[pos].lastUsed = w.clock
+	w.chunkMutex.Unlock()
+	w.invalidateLight(pos)
+}
+func (w *World) setChunk(pos world.ChunkPos, c *chunk.Chunk, b map[cube.Pos]map[string]any) *Column {
+	w.chunkMutex.Lock()
+	col := newColumn(c, b)
+	col.dirty = true
+	w.clock++
+	col.lastUsed = w.clock
+	w.chunks[pos] = col
+	w.chunkMutex.Unlock()
+	w.invalidateLight(pos)
+	return col
 }
 func (w *World) UnSetChunk(pos world.ChunkPos) {
 	w.chunkMutex.Lock()
@@ -102,6 +167,7 @@ func (w *World) SetBlockEntity(pos cube.Pos, data map[string]any) {
 	c.Lock()
 	defer c.Unlock()
 
+	c.dirty = true
 	m, ok := c.BlockEntities[pos]
 	if !ok {
 		c.BlockEntities[pos] = data
@@ -120,22 +186,46 @@ func (w *World) SetBlock(pos cube.Pos, b world.Block) world.Block {
 	return id
 }
 func (w *World) setBlock(pos cube.Pos, rid uint32) uint32 {
+	return w.setBlockLayer(pos, 0, rid)
+}
+
+// setBlockLayer sets the block at the layer passed. Layer 1 holds the liquid of waterlogged blocks.
+func (w *World) setBlockLayer(pos cube.Pos, layer uint8, rid uint32) uint32 {
+	if _, ok := w.swapBlock(pos, layer, rid); !ok {
+		return air
+	}
+	return rid
+}
+
+// swapBlock sets the block at the layer passed and returns the block it replaced. False is returned if
+// the column at the position is not loaded, in which case nothing is set.
+func (w *World) swapBlock(pos cube.Pos, layer uint8, rid uint32) (uint32, bool) {
 	if w == nil || pos.OutOfBounds(w.r) {
 		// Fast way out.
-		return air
+		return air, false
 	}
 
 	c := w.Chunk(chunkPosFromBlockPos(pos))
 	if c == nil {
-		return air
+		return air, false
 	}
-	//log.Info("locking")
 	c.Lock()
-	//log.Info("locked")
-	defer c.Unlock()
+	old := c.Block(uint8(pos.X()), int16(pos.Y()), uint8(pos.Z()), layer)
+	sub := c.SubChunk(int16(pos.Y()))
+	size := subChunkSize(sub)
+	c.SetBlock(uint8(pos.X()), int16(pos.Y()), uint8(pos.Z()), layer, rid)
+	// The palette, and with it the size of the sub chunk, may grow.
+	c.size.Add(subChunkSize(sub) - size)
+	if layer == 0 && rid != air {
+		c.raiseHeight(uint8(pos.X()), int16(pos.Y()), uint8(pos.Z()))
+	}
+	c.dirty = true
+	c.Unlock()
 
-	c.SetBlock(uint8(pos.X()), int16(pos.Y()), uint8(pos.Z()), 0, rid)
-	return rid
+	if old != rid {
+		w.invalidateLight(chunkPosFromBlockPos(pos))
+	}
+	return old, true
 }
 func (w *World) Biome(pos cube.Pos) world.Biome {
 	if w == nil || pos.OutOfBounds(w.r) {
@@ -166,6 +256,11 @@ func (w *World) Range() cube.Range {
 	return w.r
 }
 
+// Dimension returns the ID of the dimension of the World.
+func (w *World) Dimension() int {
+	return w.dimension
+}
+
 // Column represents the data of a chunk including the block entities and loaders. This data is protected
 // by the mutex present in the chunk.Chunk held.
 type Column struct {
@@ -174,11 +269,77 @@ type Column struct {
 	*chunk.Chunk
 
 	BlockEntities map[cube.Pos]map[string]any
+	// heightMap holds the height maps sent with sub chunks, if any.
+	heightMap chunk.HeightMap
+	// pending is true for the sub chunks requested from the server that were not received yet, which are
+	// empty without being air. It is nil if all sub chunks were received.
+	pending []bool
+	// dirty is true if the column changed since it was last written to a Mirror.
+	dirty bool
+	// lastUsed is the value of the clock of the World when the column was last used. It is protected by
+	// the chunk mutex of the World.
+	lastUsed uint64
+	// size is the approximate number of bytes used by the column.
+	size atomic.Int64
+	// light is how far the light of the column is calculated. It is protected by the light mutex of the
+	// World.
+	light lightState
+}
+
+// Height returns the Y coordinate just above the highest block at the x and z passed. The height map sent
+// by the server is used if the column was sent as sub chunks, in which case the height may be above the
+// highest block if blocks were removed since.
+func (c *Column) Height(x, z uint8) int16 {
+	if c.heightMap != nil {
+		return c.heightMap.At(x, z)
+	}
+	return c.HighestBlock(x, z) + 1
+}
+
+// applyHeightMap applies the height map of the sub chunk at the Y passed to the height map of the column.
+func (c *Column) applyHeightMap(subY int16, mapType byte, data []int8) {
+	if mapType != protocol.HeightMapDataHasData || len(data) != 256 {
+		return
+	}
+	if c.heightMap == nil {
+		c.heightMap = make(chunk.HeightMap, 256)
+		for i := range c.heightMap {
+			c.heightMap[i] = int16(c.Range().Min())
+		}
+	}
+	for i, h := range data {
+		// Entries outside of 0-15 are heights in sub chunks above or below this one.
+		if h < 0 || h > 15 {
+			continue
+		}
+		x, z := i&15, i>>4
+		c.heightMap[x<<4|z] = subY + int16(h)
+	}
+}
+
+// subPending checks if the sub chunk at the index passed was requested from the server but not received
+// yet.
+func (c *Column) subPending(index int) bool {
+	return index < len(c.pending) && c.pending[index]
+}
+
+// raiseHeight raises the height map sent by the server, if any, at the x and z passed if the block placed
+// at the Y passed is above it. The height map is not lowered when the highest block is removed, so it may
+// be above the highest block, but never below.
+func (c *Column) raiseHeight(x uint8, y int16, z uint8) {
+	if c.heightMap == nil {
+		return
+	}
+	if i := uint16(x&15)<<4 | uint16(z&15); y >= c.heightMap[i] {
+		c.heightMap[i] = y + 1
+	}
 }
 
 // newColumn returns a new Column wrapper around the chunk.Chunk passed.
 func newColumn(c *chunk.Chunk, b map[cube.Pos]map[string]any) *Column {
-	return &Column{Chunk: c, BlockEntities: b}
+	col := &Column{Chunk: c, BlockEntities: b}
+	col.size.Store(columnSize(c))
+	return col
 }
 
 // chunkPosFromVec3 returns a chunk position from the Vec3 passed. The coordinates of the chunk position are
@@ -3,13 +3,16 @@ module github.com/patyhank/bedrock-library
 go 1.24.0
 
 require (
+	github.com/cespare/xxhash/v2 v2.3.0
 	github.com/df-mc/atomic v1.10.0
 	github.com/df-mc/dragonfly v0.10.11-0.20260321151932-3e4f0bbedce6
+	github.com/df-mc/goleveldb v1.1.9
 	github.com/dlclark/regexp2 v1.11.5
 	github.com/fzipp/astar v0.3.0
 	github.com/go-gl/mathgl v1.2.0
 	github.com/google/uuid v1.6.0
 	github.com/goxiaoy/go-eventbus v0.0.5
+	github.com/sandertv/go-raknet v1.15.1-0.20260112202637-beca0b10c217
 	github.com/sandertv/gophertunnel v1.54.0
 	github.com/sirupsen/logrus v1.9.3
 	golang.org/x/exp v0.0.0-20251125195548-87e1e737ad39
@@ -19,11 +22,9 @@ require (
 
 require (
 	github.com/brentp/intintmap v0.0.0-20251106190759-56907b1f8479 // indirect
-	github.com/cespare/xxhash/v2 v2.3.0 // indirect
 	github.com/coreos/go-oidc/v3 v3.17.0 // indirect
 	github.com/df-mc/go-playfab v1.0.0 // indirect
 	github.com/df-mc/go-xsapi v1.0.1 // indirect
-	github.com/df-mc/goleveldb v1.1.9 // indirect
 	github.com/df-mc/jsonc v1.0.5 // indirect
 	github.com/df-mc/worldupgrader v1.0.20 // indirect
 	github.com/go-jose/go-jose/v3 v3.0.3 // indirect
@@ -34,7 +35,6 @@ require (
 	github.com/muhammadmuzzammil1998/jsonc v1.0.0 // indirect
 	github.com/pelletier/go-toml v1.9.5 // indirect
 	github.com/rogpeppe/go-internal v1.11.0 // indirect
-	github.com/sandertv/go-raknet v1.15.1-0.20260112202637-beca0b10c217 // indirect
 	github.com/segmentio/fasthash v1.0.3 // indirect
 	go.uber.org/atomic v1.10.0 // indirect
 	golang.org/x/crypto v0.44.0 // indirect